@@ -1463,6 +1463,12 @@ func (e *EscState) esccall(call *Node, parent *Node) {
 
 	case OCALLFUNC:
 		fn = call.Left
+		if fn.Op == OCLOSURE {
+			// A directly called closure is analyzed with its
+			// caller, like a call to its function, which
+			// transformclosure makes it.
+			fn = fn.Func.Closure.Func.Nname
+		}
 		fntype = fn.Type
 		indirect = fn.Op != ONAME || fn.Class() != PFUNC
 
@@ -0,0 +1,229 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Detection of lock convoys.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"internal/trace"
+	"net/http"
+	"sort"
+)
+
+func init() {
+	http.HandleFunc("/convoy", httpConvoy)
+}
+
+// minConvoyCycles is the number of complete rounds through the same
+// group of goroutines after which handoffs are reported as a convoy.
+const minConvoyCycles = 2
+
+// convoy describes a group of goroutines that repeatedly hand
+// a synchronization object over to each other.
+type convoy struct {
+	Stacks     []convoyStack `json:"stacks"`          // stacks at which the goroutines block on the object
+	Goroutines []uint64      `json:"goroutines"`      // ids of the participating goroutines
+	Size       int           `json:"size"`            // number of participating goroutines
+	Handoffs   int           `json:"handoffs"`        // number of handoffs between them
+	Cycles     int           `json:"cycles"`          // number of complete rounds through the group
+	CycleRate  float64       `json:"cyclesPerSecond"` // rounds per second while the convoy lasted
+	Waiting    []convoyPoint `json:"waiting"`         // number of goroutines blocked on the object over time
+}
+
+type convoyStack struct {
+	ID     uint64        `json:"id"`
+	Frames []convoyFrame `json:"frames"`
+}
+
+type convoyFrame struct {
+	Fn   string `json:"fn"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+type convoyPoint struct {
+	Time    int64 `json:"time"` // nanoseconds since the start of the trace
+	Waiting int   `json:"waiting"`
+}
+
+// httpConvoy serves the lock convoys detected in the trace as JSON.
+func httpConvoy(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := json.MarshalIndent(findConvoys(events), "", "\t")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal convoys: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// handoff is the unblocking of goroutine to, blocked at stack toStk, by
+// goroutine from, which was itself last unblocked while blocked at fromStk.
+type handoff struct {
+	ts             int64
+	from, to       uint64
+	fromStk, toStk uint64
+}
+
+// waitChange is a change by delta of the number of goroutines blocked at stk.
+type waitChange struct {
+	ts    int64
+	stk   uint64
+	delta int
+}
+
+// findConvoys detects lock convoys in events.
+//
+// The trace does not identify synchronization objects, so they are inferred
+// from block/unblock chains: when goroutines that were blocked at stack A
+// repeatedly unblock goroutines blocked at stack B, A and B are taken to be
+// blocking on the same object. A convoy is a group of goroutines that hand such an
+// object over to each other, in turn, for at least minConvoyCycles rounds.
+func findConvoys(events []*trace.Event) []convoy {
+	stks := make(map[uint64][]*trace.Frame)
+	objs := make(stackSets)
+	blocked := make(map[uint64]*trace.Event) // goroutine id -> its pending block event
+	last := make(map[uint64]*trace.Event)    // goroutine id -> its last completed block event
+	var handoffs []handoff
+	pairs := make(map[[2]uint64]int) // number of handoffs between two stacks
+	var changes []waitChange
+	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
+			trace.EvGoBlockSync, trace.EvGoBlockCond:
+			if ev.StkID == 0 {
+				delete(last, ev.G)
+				continue
+			}
+			stks[ev.StkID] = ev.Stk
+			objs.add(ev.StkID)
+			blocked[ev.G] = ev
+			changes = append(changes, waitChange{ev.Ts, ev.StkID, 1})
+		case trace.EvGoBlock, trace.EvGoBlockNet, trace.EvGoBlockGC,
+			trace.EvGoSleep, trace.EvGoSysBlock:
+			// The goroutine no longer holds what it was last unblocked for.
+			delete(last, ev.G)
+		case trace.EvGoUnblock:
+			g := ev.Args[0]
+			blk := blocked[g]
+			if blk == nil {
+				continue
+			}
+			delete(blocked, g)
+			changes = append(changes, waitChange{ev.Ts, blk.StkID, -1})
+			if prev := last[ev.G]; prev != nil {
+				handoffs = append(handoffs, handoff{ev.Ts, ev.G, g, prev.StkID, blk.StkID})
+				pairs[[2]uint64{prev.StkID, blk.StkID}]++
+			}
+			last[g] = blk
+		}
+	}
+
+	// A goroutine may also wake another one for unrelated reasons while
+	// holding the object, so only repeated handoffs between stacks
+	// join them.
+	for p, n := range pairs {
+		if n >= minConvoyCycles {
+			objs.union(p[0], p[1])
+		}
+	}
+	byObj := make(map[uint64][]handoff) // object -> handoffs of it
+	for _, h := range handoffs {
+		obj := objs.find(h.toStk)
+		if objs.find(h.fromStk) != obj {
+			continue
+		}
+		byObj[obj] = append(byObj[obj], h)
+	}
+	convoys := []convoy{} // marshal to an empty list rather than null
+	for obj, hs := range byObj {
+		c := convoy{Handoffs: len(hs)}
+		members := make(map[uint64]bool)
+		round := make(map[uint64]bool)
+		for _, h := range hs {
+			members[h.from] = true
+			members[h.to] = true
+			if round[h.to] {
+				c.Cycles++
+				round = make(map[uint64]bool)
+			}
+			round[h.to] = true
+		}
+		c.Size = len(members)
+		if c.Size < 2 || c.Cycles < minConvoyCycles {
+			continue
+		}
+		for g := range members {
+			c.Goroutines = append(c.Goroutines, g)
+		}
+		sort.Slice(c.Goroutines, func(i, j int) bool { return c.Goroutines[i] < c.Goroutines[j] })
+		if d := hs[len(hs)-1].ts - hs[0].ts; d > 0 {
+			c.CycleRate = float64(c.Cycles) / (float64(d) / 1e9)
+		}
+		for id := range stks {
+			if objs.find(id) == obj {
+				c.Stacks = append(c.Stacks, convoyStack{ID: id, Frames: convoyFrames(stks[id])})
+			}
+		}
+		sort.Slice(c.Stacks, func(i, j int) bool { return c.Stacks[i].ID < c.Stacks[j].ID })
+		n := 0
+		for _, ch := range changes {
+			if objs.find(ch.stk) == obj {
+				n += ch.delta
+				c.Waiting = append(c.Waiting, convoyPoint{ch.ts, n})
+			}
+		}
+		convoys = append(convoys, c)
+	}
+	sort.Slice(convoys, func(i, j int) bool {
+		if convoys[i].Handoffs != convoys[j].Handoffs {
+			return convoys[i].Handoffs > convoys[j].Handoffs
+		}
+		return convoys[i].Stacks[0].ID < convoys[j].Stacks[0].ID
+	})
+	return convoys
+}
+
+func convoyFrames(stk []*trace.Frame) []convoyFrame {
+	frames := make([]convoyFrame, len(stk))
+	for i, f := range stk {
+		frames[i] = convoyFrame{Fn: f.Fn, File: f.File, Line: f.Line}
+	}
+	return frames
+}
+
+// stackSets is a union-find forest of stack ids, mapping each id
+// to its parent. Roots map to themselves.
+type stackSets map[uint64]uint64
+
+func (s stackSets) add(id uint64) {
+	if _, ok := s[id]; !ok {
+		s[id] = id
+	}
+}
+
+func (s stackSets) find(id uint64) uint64 {
+	for s[id] != id {
+		s[id] = s[s[id]]
+		id = s[id]
+	}
+	return id
+}
+
+func (s stackSets) union(a, b uint64) {
+	a, b = s.find(a), s.find(b)
+	if a < b {
+		s[b] = a
+	} else {
+		s[a] = b
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"internal/trace"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFindConvoys(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	lock := s.add("sync.(*Mutex).Lock")
+	unlock := s.add("sync.(*Mutex).Unlock")
+
+	w.Emit(trace.EvGoCreate, 1, 1, s.add("main.worker1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 2, s.add("main.worker2"), s.add("main.main"))
+	w.Emit(trace.EvGoCreate, 1, 3, s.add("main.worker3"), s.add("main.main"))
+	w.Emit(trace.EvGoCreate, 1, 4, s.add("main.other"), s.add("main.main"))
+
+	// goroutines 2 and 3 wait for the lock held by goroutine 1.
+	w.Emit(trace.EvGoStartLocal, 1, 2)   // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSync, 1, lock) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 3)
+	w.Emit(trace.EvGoBlockSync, 1, lock)
+
+	// goroutine 4 blocks once on an unrelated channel.
+	w.Emit(trace.EvGoStartLocal, 1, 4)
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.recv"))
+
+	// The lock passes around goroutines 1, 2 and 3 three times.
+	w.Emit(trace.EvGoStartLocal, 1, 1)
+	order := []uint64{1, 2, 3}
+	for i := 0; i < 9; i++ {
+		next := order[(i+1)%len(order)]
+		w.Emit(trace.EvGoUnblockLocal, 1, next, unlock) // [timestamp, goroutine id, stack]
+		w.Emit(trace.EvGoBlockSync, 1, lock)
+		w.Emit(trace.EvGoStartLocal, 1, next)
+	}
+	// goroutine 1 wakes goroutine 4 and ends.
+	w.Emit(trace.EvGoUnblockLocal, 1, 4, s.add("main.send"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 4)
+	w.Emit(trace.EvGoEnd, 1)
+
+	res := useTrace(t, w, s)
+
+	convoys := findConvoys(res.Events)
+	if len(convoys) != 1 {
+		t.Fatalf("got %d convoys, want 1: %+v", len(convoys), convoys)
+	}
+	c := convoys[0]
+	if want := []uint64{1, 2, 3}; !reflect.DeepEqual(c.Goroutines, want) {
+		t.Errorf("got goroutines %v, want %v", c.Goroutines, want)
+	}
+	if c.Size != 3 {
+		t.Errorf("got size %d, want 3", c.Size)
+	}
+	// The first handoff is from goroutine 1, which did not wait for the lock.
+	if c.Handoffs != 8 {
+		t.Errorf("got %d handoffs, want 8", c.Handoffs)
+	}
+	if c.Cycles != 2 {
+		t.Errorf("got %d cycles, want 2", c.Cycles)
+	}
+	if c.CycleRate <= 0 {
+		t.Errorf("got cycle rate %v, want > 0", c.CycleRate)
+	}
+	if len(c.Stacks) != 1 || c.Stacks[0].ID != lock || c.Stacks[0].Frames[0].Fn != "sync.(*Mutex).Lock" {
+		t.Errorf("got stacks %+v, want only the Lock stack", c.Stacks)
+	}
+	if n := len(c.Waiting); n == 0 || c.Waiting[n-1].Waiting != 2 {
+		t.Errorf("got waiting %+v, want 2 goroutines waiting at the end", c.Waiting)
+	}
+	for _, p := range c.Waiting {
+		if p.Waiting < 0 || p.Waiting > 2 {
+			t.Errorf("got %d goroutines waiting at %d, want between 0 and 2", p.Waiting, p.Time)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	httpConvoy(rec, httptest.NewRequest("GET", "/convoy", nil))
+	var got []convoy
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to unmarshal /convoy response: %v", err)
+	}
+	if !reflect.DeepEqual(got, convoys) {
+		t.Errorf("/convoy returned %+v, want %+v", got, convoys)
+	}
+}
@@ -28,20 +28,21 @@ Open a web browser displaying trace:
 	go tool trace [flags] [pkg.test] trace.out
 
 Generate a pprof-like profile from the trace:
-    go tool trace -pprof=TYPE [pkg.test] trace.out
+    go tool trace -pprof=TYPE [-o=file] [pkg.test] trace.out
 
 [pkg.test] argument is required for traces produced by Go 1.6 and below.
 Go 1.7 does not require the binary argument.
 
 Supported profile types are:
-    - net: network blocking profile
-    - sync: synchronization blocking profile
+    - net (or io): network blocking profile
+    - sync (or block): synchronization blocking profile
     - syscall: syscall blocking profile
     - sched: scheduler latency profile
 
 Flags:
 	-http=addr: HTTP service address (e.g., ':6060')
 	-pprof=type: print a pprof-like profile instead
+	-o=file: write the -pprof profile to file instead of standard output
 	-d: print debug info such as parsed events
 
 Note that while the various profiles available when launching
@@ -53,6 +54,7 @@ and is only actively tested on that browser.
 var (
 	httpFlag  = flag.String("http", "localhost:0", "HTTP service address (e.g., ':6060')")
 	pprofFlag = flag.String("pprof", "", "print a pprof-like profile instead")
+	outFlag   = flag.String("o", "", "write the -pprof profile to `file` instead of standard output")
 	debugFlag = flag.Bool("d", false, "print debug information such as parsed events list")
 
 	// The binary file name, left here for serveSVGProfile.
@@ -79,26 +81,12 @@ func main() {
 		flag.Usage()
 	}
 
-	var pprofFunc func(io.Writer, string) error
-	switch *pprofFlag {
-	case "net":
-		pprofFunc = pprofIO
-	case "sync":
-		pprofFunc = pprofBlock
-	case "syscall":
-		pprofFunc = pprofSyscall
-	case "sched":
-		pprofFunc = pprofSched
-	}
-	if pprofFunc != nil {
-		if err := pprofFunc(os.Stdout, ""); err != nil {
-			dief("failed to generate pprof: %v\n", err)
+	if *pprofFlag != "" {
+		if err := writePprof(*pprofFlag, *outFlag); err != nil {
+			dief("%v\n", err)
 		}
 		os.Exit(0)
 	}
-	if *pprofFlag != "" {
-		dief("unknown pprof type %s\n", *pprofFlag)
-	}
 
 	ln, err := net.Listen("tcp", *httpFlag)
 	if err != nil {
@@ -199,12 +187,52 @@ var templMain = template.Must(template.New("").Parse(`
 <a href="/goroutines">Goroutine analysis</a><br>
 <a href="/io">Network blocking profile</a> (<a href="/io?raw=1" download="io.profile">⬇</a>)<br>
 <a href="/block">Synchronization blocking profile</a> (<a href="/block?raw=1" download="block.profile">⬇</a>)<br>
+<a href="/mutexholder">Mutex holder profile</a> (<a href="/mutexholder?raw=1" download="mutexholder.profile">⬇</a>)<br>
+<a href="/gcassist">GC assist profile</a> (<a href="/gcassist?raw=1" download="gcassist.profile">⬇</a>)<br>
 <a href="/syscall">Syscall blocking profile</a> (<a href="/syscall?raw=1" download="syscall.profile">⬇</a>)<br>
 <a href="/sched">Scheduler latency profile</a> (<a href="/sche?raw=1" download="sched.profile">⬇</a>)<br>
+<a href="/schedprocs">Scheduler latency profile by running Ps</a> (<a href="/schedprocs?raw=1" download="schedprocs.profile">⬇</a>)<br>
+<a href="/total">Total waiting time profile</a> (<a href="/total?raw=1" download="total.profile">⬇</a>)<br>
+<a href="/heapgrowth">Heap growth observed while goroutines ran (approximate)</a> (<a href="/heapgrowth?raw=1" download="heapgrowth.profile">⬇</a>)<br>
+<a href="/convoy">Lock convoys</a> (JSON)<br>
 </body>
 </html>
 `))
 
+// pprofTypes are the profiles selectable by the -pprof flag.
+var pprofTypes = map[string]func(io.Writer, *http.Request) error{
+	"net":     pprofIO,
+	"io":      pprofIO,
+	"sync":    pprofBlock,
+	"block":   pprofBlock,
+	"syscall": pprofSyscall,
+	"sched":   pprofSched,
+}
+
+// writePprof writes the pprof-like profile of type typ of the trace to
+// the file named output, or to standard output if output is empty.
+func writePprof(typ, output string) error {
+	prof := pprofTypes[typ]
+	if prof == nil {
+		return fmt.Errorf("unknown pprof type %s", typ)
+	}
+	if output == "" {
+		if err := prof(os.Stdout, &http.Request{}); err != nil {
+			return fmt.Errorf("failed to generate pprof: %v", err)
+		}
+		return nil
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := prof(f, &http.Request{}); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to generate pprof: %v", err)
+	}
+	return f.Close()
+}
+
 func dief(msg string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, msg, args...)
 	os.Exit(1)
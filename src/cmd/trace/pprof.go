@@ -8,16 +8,23 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"html"
 	"internal/trace"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/google/pprof/profile"
 )
@@ -37,32 +44,67 @@ func goCmd() string {
 func init() {
 	http.HandleFunc("/io", serveSVGProfile(pprofIO))
 	http.HandleFunc("/block", serveSVGProfile(pprofBlock))
+	http.HandleFunc("/mutexholder", serveSVGProfile(pprofMutexHolder))
+	http.HandleFunc("/gcassist", serveSVGProfile(pprofGCAssist))
 	http.HandleFunc("/syscall", serveSVGProfile(pprofSyscall))
 	http.HandleFunc("/sched", serveSVGProfile(pprofSched))
+	http.HandleFunc("/schedprocs", serveSVGProfile(pprofSchedProcs))
+	http.HandleFunc("/total", serveSVGProfile(pprofTotal))
+	http.HandleFunc("/heapgrowth", serveSVGProfile(pprofHeapGrowth))
 }
 
 // Record represents one entry in pprof-like profiles.
 type Record struct {
-	stk  []*trace.Frame
-	n    uint64
-	time int64
+	stk    []*trace.Frame
+	n      uint64
+	time   int64 // total delay, or bytes of heap growth
+	labels map[string][]string
 }
 
-// pprofMatchingGoroutines parses the goroutine type id string (i.e. pc)
-// and returns the ids of goroutines of the matching type.
+// recordKey identifies a Record in a profile.
+// Records with the same stack but different labels are kept apart.
+type recordKey struct {
+	stk    uint64
+	labels string // canonical form of the Record's labels
+}
+
+// newRecordKey returns the key of the Record with stack id stk and labels.
+func newRecordKey(stk uint64, labels map[string][]string) recordKey {
+	if len(labels) == 0 {
+		return recordKey{stk: stk}
+	}
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf []string
+	for _, k := range keys {
+		buf = append(buf, k+"="+strings.Join(labels[k], ","))
+	}
+	return recordKey{stk: stk, labels: strings.Join(buf, ";")}
+}
+
+// pprofMatchingGoroutines parses the goroutine type id string (i.e. pc),
+// a comma-separated list of ids, and returns the ids of goroutines of the
+// matching types.
 // If the id string is empty, returns nil without an error.
 func pprofMatchingGoroutines(id string, events []*trace.Event) (map[uint64]bool, error) {
 	if id == "" {
 		return nil, nil
 	}
-	pc, err := strconv.ParseUint(id, 10, 64) // id is string
-	if err != nil {
-		return nil, fmt.Errorf("invalid goroutine type: %v", id)
+	pcs := make(map[uint64]bool)
+	for _, s := range strings.Split(id, ",") {
+		pc, err := strconv.ParseUint(s, 10, 64) // id is string
+		if err != nil {
+			return nil, fmt.Errorf("invalid goroutine type: %v", s)
+		}
+		pcs[pc] = true
 	}
 	analyzeGoroutines(events)
 	var res map[uint64]bool
 	for _, g := range gs {
-		if g.PC != pc {
+		if !pcs[g.PC] {
 			continue
 		}
 		if res == nil {
@@ -76,143 +118,643 @@ func pprofMatchingGoroutines(id string, events []*trace.Event) (map[uint64]bool,
 	return res, nil
 }
 
+// pprofFilterGoroutines returns the ids of goroutines selected by the
+// "id" and "minexec" form values of r. The "minexec" value is the minimum
+// total execution time, in nanoseconds, of a goroutine to be included.
+// If neither value is set, returns nil without an error.
+func pprofFilterGoroutines(r *http.Request, events []*trace.Event) (map[uint64]bool, error) {
+	res, err := pprofMatchingGoroutines(r.FormValue("id"), events)
+	if err != nil {
+		return nil, err
+	}
+	minexec := r.FormValue("minexec")
+	if minexec == "" {
+		return res, nil
+	}
+	min, err := strconv.ParseInt(minexec, 10, 64)
+	if err != nil || min < 0 {
+		return nil, fmt.Errorf("invalid minimum execution time: %v", minexec)
+	}
+	analyzeGoroutines(events)
+	filtered := make(map[uint64]bool)
+	for _, g := range gs {
+		if g.ExecTime < min || (res != nil && !res[g.ID]) {
+			continue
+		}
+		filtered[g.ID] = true
+	}
+	return filtered, nil
+}
+
+// pprofLabeler computes labels for the sample of an event.
+// A nil pprofLabeler adds no labels.
+type pprofLabeler func(ev *trace.Event) map[string][]string
+
+// labels returns the labels for the sample of ev: the given labels,
+// which are modified, extended with those computed by l.
+func (l pprofLabeler) labels(ev *trace.Event, labels map[string][]string) map[string][]string {
+	if l == nil {
+		return labels
+	}
+	for k, v := range l(ev) {
+		if labels == nil {
+			labels = make(map[string][]string)
+		}
+		labels[k] = v
+	}
+	return labels
+}
+
+// pprofKeyLabeler returns the labeler selected by the "key" form value of r.
+// If the value is empty, returns nil without an error.
+func pprofKeyLabeler(r *http.Request, events []*trace.Event) (pprofLabeler, error) {
+	switch key := r.FormValue("key"); key {
+	case "":
+		return nil, nil
+	case "rootcreator":
+		return rootCreatorLabeler(events), nil
+	default:
+		return nil, fmt.Errorf("unknown profile key: %v", key)
+	}
+}
+
+// rootCreatorLabeler returns a labeler that labels the sample of an event
+// with the creation stack of the root of its goroutine's creation chain,
+// under the key "rootcreator". The chain follows EvGoCreate events
+// emitted by running goroutines, so goroutines that existed when tracing
+// started end it. The stack is formatted as function names, outermost first,
+// separated by semicolons. Events of goroutines not created during tracing
+// get no label.
+func rootCreatorLabeler(events []*trace.Event) pprofLabeler {
+	creates := make(map[uint64]*trace.Event) // goroutine id -> its EvGoCreate
+	for _, ev := range events {
+		if ev.Type == trace.EvGoCreate && ev.G != 0 {
+			creates[ev.Args[0]] = ev
+		}
+	}
+	roots := make(map[uint64][]string) // goroutine id -> label value
+	return func(ev *trace.Event) map[string][]string {
+		v, ok := roots[ev.G]
+		if !ok {
+			var root *trace.Event
+			seen := make(map[uint64]bool)
+			for g := ev.G; creates[g] != nil && !seen[g]; g = root.G {
+				seen[g] = true
+				root = creates[g]
+			}
+			if root != nil && len(root.Stk) > 0 {
+				fns := make([]string, len(root.Stk))
+				for i, f := range root.Stk {
+					fns[len(fns)-1-i] = f.Fn
+				}
+				v = []string{strings.Join(fns, ";")}
+			}
+			roots[ev.G] = v
+		}
+		if v == nil {
+			return nil
+		}
+		return map[string][]string{"rootcreator": v}
+	}
+}
+
+// gtypeLabeler returns a labeler that labels the sample of an event with
+// the type of its goroutine, the id selecting it with the "id" form
+// value, under the key "gtype". Events of goroutines of unknown type
+// get no label.
+func gtypeLabeler(events []*trace.Event) pprofLabeler {
+	analyzeGoroutines(events)
+	values := make(map[uint64][]string) // goroutine type -> label value
+	return func(ev *trace.Event) map[string][]string {
+		g := gs[ev.G]
+		if g == nil || g.PC == 0 {
+			return nil
+		}
+		v := values[g.PC]
+		if v == nil {
+			v = []string{strconv.FormatUint(g.PC, 10)}
+			values[g.PC] = v
+		}
+		return map[string][]string{"gtype": v}
+	}
+}
+
+// pprofOptions are the options, selected by form values, that apply
+// to all pprof-like profiles.
+type pprofOptions struct {
+	goroutines map[uint64]bool // if non-nil, the goroutines to include
+	gtype      pprofLabeler    // labels samples with their goroutine type
+	labeler    pprofLabeler
+	start, end int64 // time window, in nanoseconds since the start of the trace
+}
+
+// parsePprofOptions returns the options selected by the form values of r:
+//   - id and minexec: see pprofFilterGoroutines.
+//   - key: see pprofKeyLabeler.
+//   - start and end: the time window to profile, in nanoseconds since
+//     the start of the trace. Each defaults to the corresponding end of
+//     the trace.
+func parsePprofOptions(r *http.Request, events []*trace.Event) (*pprofOptions, error) {
+	opts := &pprofOptions{end: math.MaxInt64}
+	var err error
+	if opts.goroutines, err = pprofFilterGoroutines(r, events); err != nil {
+		return nil, err
+	}
+	opts.gtype = gtypeLabeler(events)
+	if opts.labeler, err = pprofKeyLabeler(r, events); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		name string
+		v    *int64
+	}{{"start", &opts.start}, {"end", &opts.end}} {
+		s := r.FormValue(f.name)
+		if s == "" {
+			continue
+		}
+		if *f.v, err = strconv.ParseInt(s, 10, 64); err != nil || *f.v < 0 {
+			return nil, fmt.Errorf("invalid %s time: %v", f.name, s)
+		}
+	}
+	if opts.end < opts.start {
+		return nil, fmt.Errorf("end time %d is before start time %d", opts.end, opts.start)
+	}
+	return opts, nil
+}
+
+// includes reports whether events of goroutine g are included in the profile.
+func (o *pprofOptions) includes(g uint64) bool {
+	return o.goroutines == nil || o.goroutines[g]
+}
+
+// labels returns the labels for the sample of ev: the given labels, which
+// are modified, extended with the type of ev's goroutine and those computed
+// by the labeler.
+func (o *pprofOptions) labels(ev *trace.Event, labels map[string][]string) map[string][]string {
+	return o.labeler.labels(ev, o.gtype.labels(ev, labels))
+}
+
+// inWindow reports whether the time ts is within the time window.
+func (o *pprofOptions) inWindow(ts int64) bool {
+	return o.start <= ts && ts <= o.end
+}
+
+// add accounts the time from ev to its Link to the Record for ev's stack
+// and labels in prof. The labels are the given ones, which are modified,
+// extended as by o.labels. Only the part of the time
+// within the time window is accounted; events entirely outside it are
+// ignored.
+func (o *pprofOptions) add(prof map[recordKey]Record, ev *trace.Event, labels map[string][]string) {
+	start, end := ev.Ts, ev.Link.Ts
+	if end < o.start || start > o.end {
+		return
+	}
+	if start < o.start {
+		start = o.start
+	}
+	if end > o.end {
+		end = o.end
+	}
+	labels = o.labels(ev, labels)
+	key := newRecordKey(ev.StkID, labels)
+	rec := prof[key]
+	rec.stk = ev.Stk
+	rec.n++
+	rec.time += end - start
+	rec.labels = labels
+	prof[key] = rec
+}
+
 // pprofIO generates IO pprof-like profile (time spent in IO wait,
 // currently only network blocking event).
-func pprofIO(w io.Writer, id string) error {
+func pprofIO(w io.Writer, r *http.Request) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	goroutines, err := pprofMatchingGoroutines(id, events)
+	opts, err := parsePprofOptions(r, events)
 	if err != nil {
 		return err
 	}
 
-	prof := make(map[uint64]Record)
+	prof := make(map[recordKey]Record)
 	for _, ev := range events {
 		if ev.Type != trace.EvGoBlockNet || ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
 			continue
 		}
-		if goroutines != nil && !goroutines[ev.G] {
+		if !opts.includes(ev.G) {
 			continue
 		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+		opts.add(prof, ev, nil)
 	}
-	return buildProfile(prof).Write(w)
+	return writeProfile(w, r, buildProfile(prof))
 }
 
 // pprofBlock generates blocking pprof-like profile (time spent blocked on synchronization primitives).
-func pprofBlock(w io.Writer, id string) error {
+func pprofBlock(w io.Writer, r *http.Request) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	goroutines, err := pprofMatchingGoroutines(id, events)
+	opts, err := parsePprofOptions(r, events)
 	if err != nil {
 		return err
 	}
 
-	prof := make(map[uint64]Record)
+	prof := make(map[recordKey]Record)
 	for _, ev := range events {
 		switch ev.Type {
 		case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
-			trace.EvGoBlockSync, trace.EvGoBlockCond, trace.EvGoBlockGC:
-			// TODO(hyangah): figure out why EvGoBlockGC should be here.
-			// EvGoBlockGC indicates the goroutine blocks on GC assist, not
-			// on synchronization primitives.
+			trace.EvGoBlockSync, trace.EvGoBlockCond:
 		default:
 			continue
 		}
 		if ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
 			continue
 		}
-		if goroutines != nil && !goroutines[ev.G] {
+		if !opts.includes(ev.G) {
 			continue
 		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+		opts.add(prof, ev, nil)
+	}
+	return writeProfile(w, r, buildProfile(prof))
+}
+
+// pprofMutexHolder generates mutex holder pprof-like profile: the time
+// goroutines spent blocked on a Mutex or RWMutex is attributed to the stack
+// at which the goroutine holding it released it, unblocking them, so that
+// the critical sections causing the contention show up.
+// The id and minexec form values select the holding goroutines.
+func pprofMutexHolder(w io.Writer, r *http.Request) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	opts, err := parsePprofOptions(r, events)
+	if err != nil {
+		return err
+	}
+
+	prof := make(map[recordKey]Record)
+	for _, ev := range events {
+		if ev.Type != trace.EvGoBlockSync || ev.Link == nil {
+			continue
+		}
+		unblock := ev.Link
+		if unblock.Type != trace.EvGoUnblock || unblock.StkID == 0 || len(unblock.Stk) == 0 {
+			continue
+		}
+		if !opts.includes(unblock.G) {
+			continue
+		}
+		// Account the wait to the holder, as an event of its own
+		// spanning the wait.
+		held := &trace.Event{
+			Type:  unblock.Type,
+			Ts:    ev.Ts,
+			P:     unblock.P,
+			G:     unblock.G,
+			StkID: unblock.StkID,
+			Stk:   unblock.Stk,
+			Link:  unblock,
+		}
+		opts.add(prof, held, nil)
+	}
+	return writeProfile(w, r, buildProfile(prof))
+}
+
+// pprofGCAssist generates GC assist pprof-like profile (time spent in GC
+// mark assists, or blocked waiting to be able to allocate during GC).
+func pprofGCAssist(w io.Writer, r *http.Request) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	opts, err := parsePprofOptions(r, events)
+	if err != nil {
+		return err
+	}
+
+	prof := make(map[recordKey]Record)
+	for _, ev := range events {
+		if (ev.Type != trace.EvGoBlockGC && ev.Type != trace.EvGCMarkAssistStart) ||
+			ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
+			continue
+		}
+		if !opts.includes(ev.G) {
+			continue
+		}
+		opts.add(prof, ev, nil)
 	}
-	return buildProfile(prof).Write(w)
+	return writeProfile(w, r, buildProfile(prof))
 }
 
 // pprofSyscall generates syscall pprof-like profile (time spent blocked in syscalls).
-func pprofSyscall(w io.Writer, id string) error {
+func pprofSyscall(w io.Writer, r *http.Request) error {
 
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	goroutines, err := pprofMatchingGoroutines(id, events)
+	opts, err := parsePprofOptions(r, events)
 	if err != nil {
 		return err
 	}
 
-	prof := make(map[uint64]Record)
+	prof := make(map[recordKey]Record)
 	for _, ev := range events {
 		if ev.Type != trace.EvGoSysCall || ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
 			continue
 		}
-		if goroutines != nil && !goroutines[ev.G] {
+		if !opts.includes(ev.G) {
 			continue
 		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
-		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+		opts.add(prof, ev, nil)
 	}
-	return buildProfile(prof).Write(w)
+	return writeProfile(w, r, buildProfile(prof))
 }
 
 // pprofSched generates scheduler latency pprof-like profile
 // (time between a goroutine become runnable and actually scheduled for execution).
-func pprofSched(w io.Writer, id string) error {
+// Each sample is labeled with the reason the goroutine became runnable
+// ("create" or "unblock") under the key "reason".
+func pprofSched(w io.Writer, r *http.Request) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	opts, err := parsePprofOptions(r, events)
+	if err != nil {
+		return err
+	}
+
+	prof := make(map[recordKey]Record)
+	for _, ev := range events {
+		if (ev.Type != trace.EvGoUnblock && ev.Type != trace.EvGoCreate) ||
+			ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
+			continue
+		}
+		if !opts.includes(ev.G) {
+			continue
+		}
+		reason := "unblock"
+		if ev.Type == trace.EvGoCreate {
+			reason = "create"
+		}
+		opts.add(prof, ev, map[string][]string{"reason": {reason}})
+	}
+	return writeProfile(w, r, buildProfile(prof))
+}
+
+// pprofTotal generates pprof-like profile of the total time goroutines spent
+// waiting, combining the IO, synchronization blocking, syscall, and scheduler
+// latency profiles. Each sample is labeled with the kind of wait ("net",
+// "sync", "syscall", or "sched") under the key "kind".
+func pprofTotal(w io.Writer, r *http.Request) error {
+	events, err := parseEvents()
+	if err != nil {
+		return err
+	}
+	opts, err := parsePprofOptions(r, events)
+	if err != nil {
+		return err
+	}
+
+	prof := make(map[recordKey]Record)
+	for _, ev := range events {
+		var kind string
+		switch ev.Type {
+		case trace.EvGoBlockNet:
+			kind = "net"
+		case trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
+			trace.EvGoBlockSync, trace.EvGoBlockCond:
+			kind = "sync"
+		case trace.EvGoSysCall:
+			kind = "syscall"
+		case trace.EvGoUnblock, trace.EvGoCreate:
+			kind = "sched"
+		default:
+			continue
+		}
+		if ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
+			continue
+		}
+		if !opts.includes(ev.G) {
+			continue
+		}
+		opts.add(prof, ev, map[string][]string{"kind": {kind}})
+	}
+	return writeProfile(w, r, buildProfile(prof))
+}
+
+// pprofSchedProcs generates scheduler latency pprof-like profile in which
+// each sample is labeled with the number of Ps that were running goroutines
+// at the moment the goroutine became runnable.
+func pprofSchedProcs(w io.Writer, r *http.Request) error {
 	events, err := parseEvents()
 	if err != nil {
 		return err
 	}
-	goroutines, err := pprofMatchingGoroutines(id, events)
+	opts, err := parsePprofOptions(r, events)
 	if err != nil {
 		return err
 	}
 
-	prof := make(map[uint64]Record)
+	running := make(map[int]bool) // Ps running a goroutine
+	prof := make(map[recordKey]Record)
 	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			running[ev.P] = true
+		case trace.EvGoEnd, trace.EvGoStop, trace.EvGoSched, trace.EvGoPreempt,
+			trace.EvGoSleep, trace.EvGoBlock, trace.EvGoBlockSend, trace.EvGoBlockRecv,
+			trace.EvGoBlockSelect, trace.EvGoBlockSync, trace.EvGoBlockCond,
+			trace.EvGoBlockNet, trace.EvGoBlockGC, trace.EvGoSysBlock:
+			delete(running, ev.P)
+		}
 		if (ev.Type != trace.EvGoUnblock && ev.Type != trace.EvGoCreate) ||
 			ev.Link == nil || ev.StkID == 0 || len(ev.Stk) == 0 {
 			continue
 		}
-		if goroutines != nil && !goroutines[ev.G] {
+		if !opts.includes(ev.G) {
+			continue
+		}
+		labels := map[string][]string{"runningp": {strconv.Itoa(len(running))}}
+		opts.add(prof, ev, labels)
+	}
+	return writeProfile(w, r, buildProfile(prof))
+}
+
+// errNoHeapEvents is returned by pprofHeapGrowth for traces
+// without heap size events.
+var errNoHeapEvents = errors.New("no heap size events in this trace")
+
+// pprofHeapGrowth generates a pprof-like profile of the growth of the heap
+// observed while goroutines ran. It is not an allocation profile: the trace
+// does not record allocation stacks, and EvHeapAlloc only carries the new
+// size of the live heap, for all Ps. The growth since the previous
+// EvHeapAlloc, which includes the allocations made by goroutines running
+// on other Ps, is attributed to the start function of the goroutine that
+// emitted the event, so the profile is only a rough approximation.
+func pprofHeapGrowth(w io.Writer, r *http.Request) error {
+	prof, err := heapGrowthRecords(r)
+	if err != nil {
+		return err
+	}
+	p := buildProfile(prof)
+	p.SampleType = []*profile.ValueType{
+		{Type: "observations", Unit: "count"},
+		{Type: "approx_heap_growth", Unit: "bytes"},
+	}
+	return writeProfile(w, r, p)
+}
+
+// heapGrowthRecords returns the Records of the profile of pprofHeapGrowth.
+func heapGrowthRecords(r *http.Request) (map[recordKey]Record, error) {
+	events, err := parseEvents()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parsePprofOptions(r, events)
+	if err != nil {
+		return nil, err
+	}
+
+	starts := make(map[uint64]*trace.Event) // goroutine id -> its first EvGoStart
+	found := false
+	var heap uint64
+	prof := make(map[recordKey]Record)
+	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			if starts[ev.G] == nil && len(ev.Stk) > 0 {
+				starts[ev.G] = ev
+			}
+			continue
+		case trace.EvHeapAlloc:
+		default:
+			continue
+		}
+		prev := heap
+		heap = ev.Args[0]
+		if !found {
+			found = true
+			continue
+		}
+		start := starts[ev.G]
+		if heap <= prev || start == nil {
+			continue
+		}
+		if !opts.includes(ev.G) || !opts.inWindow(ev.Ts) {
 			continue
 		}
-		rec := prof[ev.StkID]
-		rec.stk = ev.Stk
+		labels := opts.labels(ev, nil)
+		key := newRecordKey(start.StkID, labels)
+		rec := prof[key]
+		rec.stk = start.Stk
 		rec.n++
-		rec.time += ev.Link.Ts - ev.Ts
-		prof[ev.StkID] = rec
+		rec.time += int64(heap - prev)
+		rec.labels = labels
+		prof[key] = rec
+	}
+	if !found {
+		return nil, errNoHeapEvents
 	}
-	return buildProfile(prof).Write(w)
+	return prof, nil
+}
+
+// pprofFormat describes an output format of profiles.
+// Formats with a render function are rendered in-process;
+// the others are produced by go tool pprof.
+type pprofFormat struct {
+	flag        string // go tool pprof flag selecting the format
+	ext         string // output file extension
+	contentType string
+
+	// render writes p to w, reporting the value with the given index.
+	render func(w io.Writer, p *profile.Profile, index int) error
+}
+
+// pprofFormats are the output formats selectable by the "fmt" form value.
+var pprofFormats = map[string]pprofFormat{
+	"svg":    {flag: "-svg", ext: ".svg", contentType: "image/svg+xml"},
+	"tree":   {flag: "-tree", ext: ".txt", contentType: "text/plain; charset=utf-8"},
+	"text":   {contentType: "text/plain; charset=utf-8", render: renderText},
+	"traces": {contentType: "text/plain; charset=utf-8", render: renderTraces},
 }
 
-// serveSVGProfile serves pprof-like profile generated by prof as svg.
-func serveSVGProfile(prof func(w io.Writer, id string) error) http.HandlerFunc {
+// runPprof runs go tool pprof with the given arguments and returns
+// its combined output. It is a variable for testing.
+var runPprof = func(args ...string) ([]byte, error) {
+	return exec.Command(goCmd(), append([]string{"tool", "pprof"}, args...)...).CombinedOutput()
+}
+
+// serveSVGProfile serves pprof-like profile generated by prof as svg,
+// or in the format selected by the "fmt" form value. The "sort" form
+// value selects whether events are weighted by count (the default)
+// or by delay.
+func serveSVGProfile(prof func(w io.Writer, r *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if r.FormValue("raw") != "" {
-			w.Header().Set("Content-Type", "application/octet-stream")
-			if err := prof(w, r.FormValue("id")); err != nil {
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			var buf bytes.Buffer
+			if err := prof(&buf, r); err != nil {
 				w.Header().Set("X-Go-Pprof", "1")
 				http.Error(w, fmt.Sprintf("failed to get profile: %v", err), http.StatusInternalServerError)
 				return
 			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Vary", "Accept-Encoding")
+			// The profile is already gzip-compressed by profile.Write.
+			if acceptsGzip(r) {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(buf.Bytes())
+				return
+			}
+			zr, err := gzip.NewReader(&buf)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to decompress profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+			io.Copy(w, zr)
+			return
+		}
+
+		format := pprofFormats["svg"]
+		if f := r.FormValue("fmt"); f != "" {
+			var ok bool
+			if format, ok = pprofFormats[f]; !ok {
+				http.Error(w, fmt.Sprintf("unknown profile format %q; want one of svg, tree, text, or traces", f), http.StatusBadRequest)
+				return
+			}
+		}
+		// index selects the sample value to report: the number of
+		// events, or their total delay (or bytes of heap growth).
+		index := 0
+		switch v := r.FormValue("sort"); v {
+		case "", "count":
+		case "delay":
+			index = 1
+		default:
+			http.Error(w, fmt.Sprintf("unknown sort %q; want count or delay", v), http.StatusBadRequest)
+			return
+		}
+
+		if format.render != nil {
+			var buf bytes.Buffer
+			if err := prof(&buf, r); err != nil {
+				http.Error(w, fmt.Sprintf("failed to generate profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+			p, err := profile.Parse(&buf)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to parse profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", format.contentType)
+			if err := format.render(w, p, index); err != nil {
+				http.Error(w, fmt.Sprintf("failed to render profile: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
@@ -226,7 +768,7 @@ func serveSVGProfile(prof func(w io.Writer, id string) error) http.HandlerFunc {
 			os.Remove(blockf.Name())
 		}()
 		blockb := bufio.NewWriter(blockf)
-		if err := prof(blockb, r.FormValue("id")); err != nil {
+		if err := prof(blockb, r); err != nil {
 			http.Error(w, fmt.Sprintf("failed to generate profile: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -238,18 +780,113 @@ func serveSVGProfile(prof func(w io.Writer, id string) error) http.HandlerFunc {
 			http.Error(w, fmt.Sprintf("failed to close temp file: %v", err), http.StatusInternalServerError)
 			return
 		}
-		svgFilename := blockf.Name() + ".svg"
-		if output, err := exec.Command(goCmd(), "tool", "pprof", "-svg", "-output", svgFilename, blockf.Name()).CombinedOutput(); err != nil {
+		outFilename := blockf.Name() + format.ext
+		if output, err := runPprof(format.flag, "-sample_index", strconv.Itoa(index), "-output", outFilename, blockf.Name()); err != nil {
+			if format.flag == "-svg" && dotMissing(output) {
+				serveTextFallback(w, blockf.Name(), index)
+				return
+			}
 			http.Error(w, fmt.Sprintf("failed to execute go tool pprof: %v\n%s", err, output), http.StatusInternalServerError)
 			return
 		}
-		defer os.Remove(svgFilename)
-		w.Header().Set("Content-Type", "image/svg+xml")
-		http.ServeFile(w, r, svgFilename)
+		defer os.Remove(outFilename)
+		w.Header().Set("Content-Type", format.contentType)
+		http.ServeFile(w, r, outFilename)
+	}
+}
+
+// dotMissing reports whether output, from a failed run of go tool pprof,
+// says that it could not execute dot, which renders graphs.
+func dotMissing(output []byte) bool {
+	// See invokeDot in cmd/vendor/github.com/google/pprof/internal/driver.
+	return bytes.Contains(output, []byte("Failed to execute dot."))
+}
+
+// serveTextFallback serves the profile in the file named filename as the
+// in-process text listing, wrapped in an HTML page explaining that the
+// graph could not be rendered because Graphviz is not installed.
+func serveTextFallback(w http.ResponseWriter, filename string, index int) {
+	f, err := os.Open(filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to open profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := renderText(&buf, p, index); err != nil {
+		http.Error(w, fmt.Sprintf("failed to render profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<html>
+<body>
+<p>The graph could not be rendered because dot is not installed.
+Install Graphviz (https://graphviz.org) to view the profile as an SVG graph;
+the functions of the profile are listed below instead.</p>
+<pre>%s</pre>
+</body>
+</html>
+`, html.EscapeString(buf.String()))
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r
+// allows a gzip-encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header["Accept-Encoding"] {
+		for _, coding := range strings.Split(v, ",") {
+			params := strings.Split(coding, ";")
+			if name := strings.TrimSpace(params[0]); name != "gzip" && name != "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range params[1:] {
+				if p := strings.TrimSpace(param); strings.HasPrefix(p, "q=") {
+					var err error
+					if q, err = strconv.ParseFloat(p[len("q="):], 64); err != nil {
+						q = 0
+					}
+				}
+			}
+			if q > 0 {
+				return true
+			}
+		}
 	}
+	return false
 }
 
-func buildProfile(prof map[uint64]Record) *profile.Profile {
+// writeProfile writes p to w, after applying the options selected by
+// the form values of r:
+//   - trimpath: a list of path prefixes, in the format of GOPATH, to
+//     remove from source file names, as with go tool pprof -trim_path.
+func writeProfile(w io.Writer, r *http.Request, p *profile.Profile) error {
+	if prefixes := filepath.SplitList(r.FormValue("trimpath")); len(prefixes) > 0 {
+		for _, fn := range p.Function {
+			fn.Filename = trimPath(fn.Filename, prefixes)
+		}
+	}
+	return p.Write(w)
+}
+
+// trimPath removes the first of prefixes that is a leading directory of
+// file from it.
+func trimPath(file string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || !strings.HasPrefix(file, prefix+"/") {
+			continue
+		}
+		return file[len(prefix)+1:]
+	}
+	return file
+}
+
+func buildProfile(prof map[recordKey]Record) *profile.Profile {
 	p := &profile.Profile{
 		PeriodType: &profile.ValueType{Type: "trace", Unit: "count"},
 		Period:     1,
@@ -259,13 +896,17 @@ func buildProfile(prof map[uint64]Record) *profile.Profile {
 		},
 	}
 	locs := make(map[uint64]*profile.Location)
-	funcs := make(map[string]*profile.Function)
+	type funcKey struct {
+		file, fn string
+	}
+	funcs := make(map[funcKey]*profile.Function)
 	for _, rec := range prof {
 		var sloc []*profile.Location
 		for _, frame := range rec.stk {
 			loc := locs[frame.PC]
 			if loc == nil {
-				fn := funcs[frame.File+frame.Fn]
+				key := funcKey{frame.File, frame.Fn}
+				fn := funcs[key]
 				if fn == nil {
 					fn = &profile.Function{
 						ID:         uint64(len(p.Function) + 1),
@@ -274,7 +915,7 @@ func buildProfile(prof map[uint64]Record) *profile.Profile {
 						Filename:   frame.File,
 					}
 					p.Function = append(p.Function, fn)
-					funcs[frame.File+frame.Fn] = fn
+					funcs[key] = fn
 				}
 				loc = &profile.Location{
 					ID:      uint64(len(p.Location) + 1),
@@ -294,6 +935,7 @@ func buildProfile(prof map[uint64]Record) *profile.Profile {
 		p.Sample = append(p.Sample, &profile.Sample{
 			Value:    []int64{int64(rec.n), rec.time},
 			Location: sloc,
+			Label:    rec.labels,
 		})
 	}
 	return p
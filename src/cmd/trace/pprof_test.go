@@ -0,0 +1,1019 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"internal/trace"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// useTrace parses the trace written to w, attaches the fake stacks s
+// to its events, and makes it the trace returned by parseTrace.
+func useTrace(t *testing.T, w *trace.Writer, s stacks) trace.ParseResult {
+	res, err := trace.Parse(w, "")
+	if err != nil {
+		t.Fatalf("failed to parse test trace: %v", err)
+	}
+	for _, ev := range res.Events {
+		if ev.StkID != 0 {
+			ev.Stk = s[ev.StkID]
+		}
+	}
+	res.Stacks = s // use fake stacks.
+
+	loader.once.Do(func() {})
+	loader.res = res
+	loader.err = nil
+	gsInit = sync.Once{}
+	gs = nil
+	return res
+}
+
+// getProfile runs prof with the request for url and parses the result.
+func getProfile(t *testing.T, prof func(w io.Writer, r *http.Request) error, url string) *profile.Profile {
+	var buf bytes.Buffer
+	if err := prof(&buf, httptest.NewRequest("GET", url, nil)); err != nil {
+		t.Fatalf("%s: failed to generate profile: %v", url, err)
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("%s: failed to parse profile: %v", url, err)
+	}
+	return p
+}
+
+// sampleFuncs returns the sorted names of the leaf functions of p's samples.
+func sampleFuncs(p *profile.Profile) []string {
+	var fns []string
+	for _, s := range p.Sample {
+		fns = append(fns, s.Location[0].Line[0].Function.Name)
+	}
+	sort.Strings(fns)
+	return fns
+}
+
+func TestPprofMinExec(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.short"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.long"), s.add("main.main"))
+
+	// goroutine 10: runs for 1s and blocks.
+	w.Emit(trace.EvGoStartLocal, 1, 10)                  // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.short1")) // [timestamp, stack]
+
+	// goroutine 20: runs for 10s, unblocks 10 and blocks.
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 10, 10, s.add("main.long1")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.long2"))
+
+	// goroutine 10: unblocks 20 and ends.
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.short2"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		url  string
+		want []string
+	}{
+		{"/block", []string{"main.long2", "main.short1"}},
+		{"/block?minexec=5000000000", []string{"main.long2"}},
+		{"/block?minexec=50000000000", nil},
+	} {
+		p := getProfile(t, pprofBlock, test.url)
+		if got := sampleFuncs(p); !equalStrings(got, test.want) {
+			t.Errorf("%s: got samples for %v, want %v", test.url, got, test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pprofBlock(&buf, httptest.NewRequest("GET", "/block?minexec=-1", nil)); err == nil {
+		t.Errorf("negative minexec: got no error")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPprofSchedProcs(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+
+	// P 0: no P is running when goroutines 1 and 2 are created.
+	w.Emit(trace.EvGoCreate, 1, 1, s.add("main.g1"), s.add("main.init1")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 0, 2, s.add("main.g2"), s.add("main.init2"))
+	w.Emit(trace.EvGoStartLocal, 0, 1) // [timestamp, goroutine id]
+	// Only P 0 is running.
+	w.Emit(trace.EvGoCreate, 0, 3, s.add("main.g3"), s.add("main.one"))
+	// P 1 started goroutine 2 at time 2.
+	w.Emit(trace.EvGoCreate, 2, 4, s.add("main.g4"), s.add("main.two"))
+	w.Emit(trace.EvGoEnd, 6) // [timestamp]
+
+	// P 1: runs goroutine 2, then goroutines 3 and 4.
+	w.Emit(trace.EvBatch, 1, 2)
+	w.Emit(trace.EvGoStart, 0, 2, 1) // [timestamp, goroutine id, seq]
+	w.Emit(trace.EvGoEnd, 2)
+	w.Emit(trace.EvGoStart, 1, 3, 1)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStart, 1, 4, 1)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	p := getProfile(t, pprofSchedProcs, "/schedprocs")
+	want := map[string]string{
+		"main.init1": "0",
+		"main.init2": "0",
+		"main.one":   "1",
+		"main.two":   "2",
+	}
+	got := make(map[string]string)
+	for _, s := range p.Sample {
+		got[s.Location[0].Line[0].Function.Name] = strings.Join(s.Label["runningp"], ",")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got runningp labels %v, want %v", got, want)
+	}
+}
+
+func TestServeProfileFormat(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoStartLocal, 1, 10)                                   // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send"))                    // [timestamp, stack]
+	useTrace(t, w, s)
+
+	origRunPprof := runPprof
+	defer func() { runPprof = origRunPprof }()
+	var args []string
+	runPprof = func(a ...string) ([]byte, error) {
+		args = a
+		for i := range a {
+			if a[i] == "-output" {
+				return nil, ioutil.WriteFile(a[i+1], []byte("output"), 0666)
+			}
+		}
+		return nil, fmt.Errorf("no -output flag in %v", a)
+	}
+
+	for _, test := range []struct {
+		url         string
+		flag        string
+		contentType string
+	}{
+		{"/block", "-svg", "image/svg+xml"},
+		{"/block?fmt=svg", "-svg", "image/svg+xml"},
+		{"/block?fmt=tree", "-tree", "text/plain; charset=utf-8"},
+		{"/block?sort=count", "-svg", "image/svg+xml"},
+		{"/block?sort=delay", "-svg", "image/svg+xml"},
+	} {
+		args = nil
+		rec := httptest.NewRecorder()
+		serveSVGProfile(pprofBlock)(rec, httptest.NewRequest("GET", test.url, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d; body: %s", test.url, rec.Code, http.StatusOK, rec.Body)
+			continue
+		}
+		if len(args) == 0 || args[0] != test.flag {
+			t.Errorf("%s: got go tool pprof arguments %v, want %s first", test.url, args, test.flag)
+		}
+		index := "0"
+		if strings.Contains(test.url, "sort=delay") {
+			index = "1"
+		}
+		if len(args) < 3 || args[1] != "-sample_index" || args[2] != index {
+			t.Errorf("%s: got go tool pprof arguments %v, want -sample_index %s", test.url, args, index)
+		}
+		if got := rec.HeaderMap.Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: got Content-Type %q, want %q", test.url, got, test.contentType)
+		}
+		if got := rec.Body.String(); got != "output" {
+			t.Errorf("%s: got body %q, want %q", test.url, got, "output")
+		}
+	}
+
+	for _, url := range []string{"/block?fmt=bogus", "/block?sort=bogus"} {
+		rec := httptest.NewRecorder()
+		serveSVGProfile(pprofBlock)(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", url, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServeProfileDotMissing(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoStartLocal, 1, 10)                                   // [timestamp, goroutine id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f2"), s.add("main.main"))
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.recv")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoEnd, 1)                                  // [timestamp]
+	useTrace(t, w, s)
+
+	origRunPprof := runPprof
+	defer func() { runPprof = origRunPprof }()
+	runPprof = func(a ...string) ([]byte, error) {
+		return []byte(`Failed to execute dot. Is Graphviz installed? Error: exec: "dot": executable file not found in $PATH` + "\n"), errors.New("exit status 2")
+	}
+
+	rec := httptest.NewRecorder()
+	serveSVGProfile(pprofBlock)(rec, httptest.NewRequest("GET", "/block", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got, want := rec.HeaderMap.Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf("got Content-Type %q, want %q", got, want)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"dot is not installed", "Graphviz", "main.send"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+
+	// Other failures are still reported as errors.
+	runPprof = func(a ...string) ([]byte, error) {
+		return []byte("some other failure"), errors.New("exit status 1")
+	}
+	rec = httptest.NewRecorder()
+	serveSVGProfile(pprofBlock)(rec, httptest.NewRequest("GET", "/block", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPprofRootCreator(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+
+	// goroutine 1 exists when tracing starts.
+	w.Emit(trace.EvGoCreate, 1, 1, s.add("main.serve"), s.add("runtime/trace.Start")) // [timestamp, new goroutine id, new stack id, stack id]
+
+	// goroutine 1 creates goroutine 2, which creates goroutine 3.
+	w.Emit(trace.EvGoStartLocal, 1, 1) // [timestamp, goroutine id]
+	w.Emit(trace.EvGoCreate, 1, 2, s.add("main.handler"), s.add("main.serve1"))
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.serveBlock")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 2)
+	w.Emit(trace.EvGoCreate, 1, 3, s.add("main.worker"), s.add("main.handler1"))
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.handlerBlock"))
+	w.Emit(trace.EvGoStartLocal, 1, 3)
+	w.Emit(trace.EvGoUnblockLocal, 1, 1, s.add("main.worker1")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoUnblockLocal, 1, 2, s.add("main.worker2"))
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.workerBlock"))
+
+	w.Emit(trace.EvGoStartLocal, 1, 1)
+	w.Emit(trace.EvGoUnblockLocal, 1, 3, s.add("main.serve2"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 2)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStartLocal, 1, 3)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	p := getProfile(t, pprofBlock, "/block?key=rootcreator")
+	want := map[string]string{
+		"main.serveBlock":   "",
+		"main.handlerBlock": "main.serve1",
+		"main.workerBlock":  "main.serve1",
+	}
+	got := make(map[string]string)
+	for _, s := range p.Sample {
+		got[s.Location[0].Line[0].Function.Name] = strings.Join(s.Label["rootcreator"], ",")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rootcreator labels %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := pprofBlock(&buf, httptest.NewRequest("GET", "/block?key=bogus", nil)); err == nil {
+		t.Errorf("key=bogus: got no error")
+	}
+}
+
+func TestPprofGoroutineType(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	worker, other, main := s.add("main.worker"), s.add("main.other"), s.add("main.main")
+	w.Emit(trace.EvGoCreate, 1, 10, worker, main) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, other, main)
+	w.Emit(trace.EvGoCreate, 1, 30, worker, main)
+
+	// goroutines 10 and 20, of different types, block at the same stack.
+	send := s.add("main.send")
+	w.Emit(trace.EvGoStartLocal, 1, 10)  // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, send) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoBlockSend, 1, send)
+
+	// goroutine 30 unblocks goroutine 10 after 6s and 20 after 8s.
+	w.Emit(trace.EvGoStartLocal, 1, 30)
+	w.Emit(trace.EvGoUnblockLocal, 3, 10, s.add("main.recv1")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoUnblockLocal, 4, 20, s.add("main.recv2"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	workerType, otherType := fmt.Sprint(s[worker][0].PC), fmt.Sprint(s[other][0].PC)
+	for _, test := range []struct {
+		url  string
+		want map[string]int64
+	}{
+		{"/block", map[string]int64{workerType: 6e9, otherType: 8e9}},
+		{"/block?id=" + otherType, map[string]int64{otherType: 8e9}},
+	} {
+		p := getProfile(t, pprofBlock, test.url)
+		got := make(map[string]int64)
+		for _, s := range p.Sample {
+			if fn := s.Location[0].Line[0].Function.Name; fn != "main.send" {
+				t.Errorf("%s: got sample at %s, want main.send", test.url, fn)
+			}
+			got[strings.Join(s.Label["gtype"], ",")] += s.Value[1]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got delays by gtype %v, want %v", test.url, got, test.want)
+		}
+	}
+
+	// Scheduler latency samples are events of the unblocking goroutine.
+	p := getProfile(t, pprofSched, "/sched")
+	for _, s := range p.Sample {
+		if s.Label["reason"][0] != "unblock" {
+			continue
+		}
+		if got := strings.Join(s.Label["gtype"], ","); got != workerType {
+			t.Errorf("/sched: got gtype %q for %s, want %s", got, s.Location[0].Line[0].Function.Name, workerType)
+		}
+	}
+}
+
+func TestPprofHeapGrowth(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.a"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.b"), s.add("main.main"))
+	w.Emit(trace.EvHeapAlloc, 1, 1000) // [timestamp, heap_alloc]
+
+	w.Emit(trace.EvGoStartLocal, 1, 10) // [timestamp, goroutine id]
+	w.Emit(trace.EvHeapAlloc, 1, 1100)
+	w.Emit(trace.EvHeapAlloc, 1, 1300)
+	w.Emit(trace.EvGoSched, 1, s.add("main.a1")) // [timestamp, stack]
+
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvHeapAlloc, 1, 1700)
+	w.Emit(trace.EvHeapAlloc, 1, 500) // heap shrinks after sweeping
+	w.Emit(trace.EvHeapAlloc, 1, 550)
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+
+	useTrace(t, w, s)
+
+	p := getProfile(t, pprofHeapGrowth, "/heapgrowth")
+	if got := p.SampleType[1]; got.Type != "approx_heap_growth" || got.Unit != "bytes" {
+		t.Errorf("got sample type %s/%s, want approx_heap_growth/bytes", got.Type, got.Unit)
+	}
+	want := map[string]int64{
+		"main.a": 300,
+		"main.b": 450,
+	}
+	got := make(map[string]int64)
+	for _, s := range p.Sample {
+		got[s.Location[0].Line[0].Function.Name] = s.Value[1]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got heap growth %v, want %v", got, want)
+	}
+
+	w = trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)
+	w.Emit(trace.EvFrequency, 1)
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.c"), s.add("main.main"))
+	useTrace(t, w, s)
+
+	var buf bytes.Buffer
+	if err := pprofHeapGrowth(&buf, httptest.NewRequest("GET", "/heapgrowth", nil)); err != errNoHeapEvents {
+		t.Errorf("got error %v, want %v", err, errNoHeapEvents)
+	}
+}
+
+func TestPprofTrimPath(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoStartLocal, 1, 10)                                   // [timestamp, goroutine id]
+	send := s.add("main.send")
+	w.Emit(trace.EvGoBlockSend, 1, send) // [timestamp, stack]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f2"), s.add("main.main"))
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.f2unblock")) // [timestamp, goroutine id, stack]
+	recv := s.add("runtime.chanrecv")
+	w.Emit(trace.EvGoBlockRecv, 1, recv)
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.f1unblock"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+	s[send][0].File = "/home/gopher/go/src/example.com/app/main.go"
+	s[recv][0].File = "/usr/local/go/src/runtime/chan.go"
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		url  string
+		want []string
+	}{
+		{"/block", []string{
+			"/home/gopher/go/src/example.com/app/main.go",
+			"/usr/local/go/src/runtime/chan.go",
+		}},
+		{"/block?trimpath=/usr/local/go/src/", []string{
+			"/home/gopher/go/src/example.com/app/main.go",
+			"runtime/chan.go",
+		}},
+		{"/block?trimpath=/usr/local/go/src:/home/gopher/go/src", []string{
+			"example.com/app/main.go",
+			"runtime/chan.go",
+		}},
+		{"/block?trimpath=/usr/local/go/sr", []string{
+			"/home/gopher/go/src/example.com/app/main.go",
+			"/usr/local/go/src/runtime/chan.go",
+		}},
+	} {
+		p := getProfile(t, pprofBlock, test.url)
+		var got []string
+		for _, fn := range p.Function {
+			if fn.Filename != "" {
+				got = append(got, fn.Filename)
+			}
+		}
+		sort.Strings(got)
+		if !equalStrings(got, test.want) {
+			t.Errorf("%s: got file names %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestPprofGCAssist(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.alloc"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.sync"), s.add("main.main"))
+
+	// goroutine 20 blocks on a channel for 5s.
+	w.Emit(trace.EvGoStartLocal, 1, 20)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+
+	// goroutine 10 assists for 2s, wakes goroutine 20, then blocks
+	// on GC assist for 3s.
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGCMarkAssistStart, 1, s.add("main.assist"))
+	w.Emit(trace.EvGCMarkAssistDone, 2)                       // [timestamp]
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.wake")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockGC, 1, s.add("main.blockgc"))
+
+	// goroutine 20 wakes goroutine 10.
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 2, 10, s.add("main.wake"))
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		prof func(io.Writer, *http.Request) error
+		url  string
+		want map[string]int64
+	}{
+		{pprofGCAssist, "/gcassist", map[string]int64{"main.assist": 2e9, "main.blockgc": 3e9}},
+		{pprofBlock, "/block", map[string]int64{"main.send": 5e9}},
+	} {
+		p := getProfile(t, test.prof, test.url)
+		got := make(map[string]int64)
+		for _, s := range p.Sample {
+			got[s.Location[0].Line[0].Function.Name] = s.Value[1]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got delays %v, want %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestPprofMutexHolder(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.holder"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.waiter"), s.add("main.main"))
+	w.Emit(trace.EvGoCreate, 1, 30, s.add("main.receiver"), s.add("main.main"))
+
+	// goroutine 30 blocks on a channel, and goroutine 20 on a mutex
+	// held by goroutine 10.
+	w.Emit(trace.EvGoStartLocal, 1, 30)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.recv")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoBlockSync, 1, s.add("main.lock"))
+
+	// goroutine 10 releases the mutex after 4s and sends on the
+	// channel 2s later.
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 4, 20, s.add("main.unlock")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoUnblockLocal, 2, 30, s.add("main.send"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStartLocal, 1, 30)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		prof func(io.Writer, *http.Request) error
+		url  string
+		want map[string]int64
+	}{
+		{pprofMutexHolder, "/mutexholder", map[string]int64{"main.unlock": 5e9}},
+		{pprofBlock, "/block", map[string]int64{"main.lock": 5e9, "main.recv": 9e9}},
+	} {
+		p := getProfile(t, test.prof, test.url)
+		got := make(map[string]int64)
+		for _, s := range p.Sample {
+			got[s.Location[0].Line[0].Function.Name] = s.Value[1]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got delays %v, want %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f2"), s.add("main.main"))
+	w.Emit(trace.EvGoStartLocal, 1, 10)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 3, 10, s.add("main.recv")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoEnd, 1)                                  // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoEnd, 1)
+	useTrace(t, w, s)
+
+	dir, err := ioutil.TempDir("", "trace-pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "block.profile")
+	if err := writePprof("block", output); err != nil {
+		t.Fatalf("writePprof: %v", err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+	if got, want := sampleFuncs(p), []string{"main.send"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got samples %v, want %v", got, want)
+	}
+
+	if err := writePprof("bogus", output); err == nil {
+		t.Errorf("writePprof with an unknown type succeeded")
+	}
+}
+
+func TestPprofTimeWindow(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f2"), s.add("main.main"))
+
+	// goroutine 10 blocks from 3s to 9s. Times are relative to the first event.
+	w.Emit(trace.EvGoStartLocal, 1, 10)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+
+	// goroutine 20 blocks from 10s to 12s.
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 5, 10, s.add("main.f2unblock")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.recv"))
+
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.f1unblock"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		url  string
+		want map[string]int64
+	}{
+		{"/block", map[string]int64{"main.send": 6e9, "main.recv": 2e9}},
+		{"/block?start=4000000000&end=11000000000", map[string]int64{"main.send": 5e9, "main.recv": 1e9}},
+		{"/block?start=9500000000", map[string]int64{"main.recv": 2e9}},
+		{"/block?end=3500000000", map[string]int64{"main.send": 5e8}},
+		{"/block?end=2000000000", map[string]int64{}},
+	} {
+		p := getProfile(t, pprofBlock, test.url)
+		got := make(map[string]int64)
+		for _, s := range p.Sample {
+			got[s.Location[0].Line[0].Function.Name] = s.Value[1]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got delays %v, want %v", test.url, got, test.want)
+		}
+	}
+
+	for _, url := range []string{
+		"/block?start=-1",
+		"/block?end=x",
+		"/block?start=8000000000&end=7000000000",
+	} {
+		var buf bytes.Buffer
+		if err := pprofBlock(&buf, httptest.NewRequest("GET", url, nil)); err == nil {
+			t.Errorf("%s: got no error", url)
+		}
+	}
+}
+
+func TestServeProfileText(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f2"), s.add("main.main"))
+	w.Emit(trace.EvGoStartLocal, 1, 10)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.f2unblock")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockRecv, 1, s.add("main.recv"))
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 3, 20, s.add("main.f1unblock"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+	useTrace(t, w, s)
+
+	origRunPprof := runPprof
+	defer func() { runPprof = origRunPprof }()
+	runPprof = func(a ...string) ([]byte, error) {
+		t.Errorf("go tool pprof run with %v", a)
+		return nil, fmt.Errorf("unexpected go tool pprof run")
+	}
+
+	for _, test := range []struct {
+		url  string
+		want []string // lines that must appear in order
+	}{
+		{"/block?fmt=text", []string{
+			"Type: contentions",
+			"Total: 2",
+			"         1 50.00% 50.00%          1 50.00%  main.recv",
+			"         1 50.00%   100%          1 50.00%  main.send",
+		}},
+		{"/block?fmt=text&sort=delay", []string{
+			"Type: delay",
+			"Total: 6s",
+			"        4s 66.67% 66.67%         4s 66.67%  main.recv",
+			"        2s 33.33%   100%         2s 33.33%  main.send",
+		}},
+		{"/block?fmt=traces", []string{
+			"Type: contentions",
+			"-----------+-------------------------------------------------------",
+			"         1   main.recv",
+			"-----------+-------------------------------------------------------",
+			"         1   main.send",
+			"-----------+-------------------------------------------------------",
+		}},
+	} {
+		rec := httptest.NewRecorder()
+		serveSVGProfile(pprofBlock)(rec, httptest.NewRequest("GET", test.url, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d; body: %s", test.url, rec.Code, http.StatusOK, rec.Body)
+			continue
+		}
+		if got, want := rec.HeaderMap.Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+			t.Errorf("%s: got Content-Type %q, want %q", test.url, got, want)
+		}
+		body := rec.Body.String()
+		rest := body
+		for _, line := range test.want {
+			i := strings.Index(rest, line+"\n")
+			if i < 0 {
+				t.Errorf("%s: missing line %q in order in output:\n%s", test.url, line, body)
+				break
+			}
+			rest = rest[i+len(line)+1:]
+		}
+	}
+}
+
+func TestPprofMultipleIDs(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	a, b, c := s.add("main.a"), s.add("main.b"), s.add("main.c")
+	w.Emit(trace.EvGoCreate, 1, 10, a, s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, b, s.add("main.main"))
+	w.Emit(trace.EvGoCreate, 1, 30, c, s.add("main.main"))
+
+	// Each goroutine blocks and is woken by the next one.
+	w.Emit(trace.EvGoStartLocal, 1, 10)                  // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.ablock")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.bwake")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.bblock"))
+	w.Emit(trace.EvGoStartLocal, 1, 30)
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.cwake"))
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.cblock"))
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 1, 30, s.add("main.awake"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+	w.Emit(trace.EvGoStartLocal, 1, 30)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		url  string
+		want []string
+	}{
+		{"/block", []string{"main.ablock", "main.bblock", "main.cblock"}},
+		{fmt.Sprintf("/block?id=%d", b), []string{"main.bblock"}},
+		{fmt.Sprintf("/block?id=%d,%d", a, c), []string{"main.ablock", "main.cblock"}},
+	} {
+		p := getProfile(t, pprofBlock, test.url)
+		if got := sampleFuncs(p); !equalStrings(got, test.want) {
+			t.Errorf("%s: got samples for %v, want %v", test.url, got, test.want)
+		}
+	}
+
+	for _, url := range []string{
+		fmt.Sprintf("/block?id=%d,x", a),
+		fmt.Sprintf("/block?id=%d,", a),
+		"/block?id=999,998",
+	} {
+		var buf bytes.Buffer
+		if err := pprofBlock(&buf, httptest.NewRequest("GET", url, nil)); err == nil {
+			t.Errorf("%s: got no error", url)
+		}
+	}
+}
+
+func TestPprofTotal(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	f10 := s.add("main.f10")
+	w.Emit(trace.EvGoCreate, 1, 10, f10, s.add("main.create10")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f20"), s.add("main.create20"))
+
+	// goroutine 10 waits on the network and is woken by goroutine 20,
+	// which then blocks on a channel until goroutine 10 wakes it.
+	w.Emit(trace.EvGoStartLocal, 1, 10)               // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockNet, 1, s.add("main.read")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.wake10")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send"))
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoUnblockLocal, 1, 20, s.add("main.wake20"))
+	w.Emit(trace.EvGoEnd, 1) // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	type kindDelay struct {
+		kind  string
+		delay int64
+	}
+	for _, test := range []struct {
+		url  string
+		want map[string]kindDelay
+	}{
+		{"/total", map[string]kindDelay{
+			"main.create10": {"sched", 2e9},
+			"main.create20": {"sched", 3e9},
+			"main.read":     {"net", 2e9},
+			"main.wake10":   {"sched", 2e9},
+			"main.send":     {"sync", 2e9},
+			"main.wake20":   {"sched", 2e9},
+		}},
+		// Scheduler latency is attributed to the waking goroutine,
+		// as in the /sched profile.
+		{fmt.Sprintf("/total?id=%d", f10), map[string]kindDelay{
+			"main.read":   {"net", 2e9},
+			"main.wake20": {"sched", 2e9},
+		}},
+	} {
+		p := getProfile(t, pprofTotal, test.url)
+		got := make(map[string]kindDelay)
+		for _, s := range p.Sample {
+			got[s.Location[0].Line[0].Function.Name] = kindDelay{strings.Join(s.Label["kind"], ","), s.Value[1]}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestBuildProfileFunctions(t *testing.T) {
+	// The file and function names concatenate to the same string.
+	prof := map[recordKey]Record{
+		{stk: 1}: {stk: []*trace.Frame{{PC: 1, Fn: "bc", File: "a", Line: 1}}, n: 1},
+		{stk: 2}: {stk: []*trace.Frame{{PC: 2, Fn: "c", File: "ab", Line: 1}}, n: 1},
+	}
+	p := buildProfile(prof)
+	if len(p.Function) != 2 {
+		t.Fatalf("got %d functions, want 2", len(p.Function))
+	}
+	want := map[uint64]string{1: "a bc", 2: "ab c"} // PC -> file and function
+	for _, loc := range p.Location {
+		fn := loc.Line[0].Function
+		if got := fn.Filename + " " + fn.Name; got != want[loc.Address] {
+			t.Errorf("location %#x: got function %q, want %q", loc.Address, got, want[loc.Address])
+		}
+	}
+}
+
+func TestServeProfileRaw(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f1"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoStartLocal, 1, 10)                                   // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send"))                    // [timestamp, stack]
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.wake"))             // [timestamp, goroutine id, stack]
+	useTrace(t, w, s)
+
+	for _, test := range []struct {
+		acceptEncoding  string
+		contentEncoding string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip;q=0.5", "gzip"},
+		{"gzip;q=0", ""},
+		{"identity", ""},
+	} {
+		req := httptest.NewRequest("GET", "/block?raw=1", nil)
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		serveSVGProfile(pprofBlock)(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Accept-Encoding %q: got status %d, want %d; body: %s", test.acceptEncoding, rec.Code, http.StatusOK, rec.Body)
+			continue
+		}
+		body := rec.Body.Bytes()
+		if got := rec.HeaderMap.Get("Content-Encoding"); got != test.contentEncoding {
+			t.Errorf("Accept-Encoding %q: got Content-Encoding %q, want %q", test.acceptEncoding, got, test.contentEncoding)
+			continue
+		}
+		if test.contentEncoding == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Errorf("Accept-Encoding %q: %v", test.acceptEncoding, err)
+				continue
+			}
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				t.Errorf("Accept-Encoding %q: %v", test.acceptEncoding, err)
+				continue
+			}
+		}
+		if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+			t.Errorf("Accept-Encoding %q: decoded body is still gzip-compressed", test.acceptEncoding)
+		}
+		p, err := profile.ParseData(body)
+		if err != nil {
+			t.Errorf("Accept-Encoding %q: failed to parse profile: %v", test.acceptEncoding, err)
+			continue
+		}
+		if got, want := sampleFuncs(p), []string{"main.send"}; !equalStrings(got, want) {
+			t.Errorf("Accept-Encoding %q: got samples for %v, want %v", test.acceptEncoding, got, want)
+		}
+	}
+}
+
+func TestPprofSchedReason(t *testing.T) {
+	w := trace.NewWriter()
+	w.Emit(trace.EvBatch, 0, 0)  // start of per-P batch event [pid, timestamp]
+	w.Emit(trace.EvFrequency, 1) // [ticks per second]
+
+	var s stacks
+	w.Emit(trace.EvGoCreate, 1, 10, s.add("main.f10"), s.add("main.main")) // [timestamp, new goroutine id, new stack id, stack id]
+	w.Emit(trace.EvGoCreate, 1, 20, s.add("main.f20"), s.add("main.main"))
+
+	// goroutines 10 and 20 wait 2s and 3s to start after creation;
+	// goroutine 10 waits 2s to run again after goroutine 20 wakes it.
+	w.Emit(trace.EvGoStartLocal, 1, 10)                // [timestamp, goroutine id]
+	w.Emit(trace.EvGoBlockSend, 1, s.add("main.send")) // [timestamp, stack]
+	w.Emit(trace.EvGoStartLocal, 1, 20)
+	w.Emit(trace.EvGoUnblockLocal, 1, 10, s.add("main.wake")) // [timestamp, goroutine id, stack]
+	w.Emit(trace.EvGoEnd, 1)                                  // [timestamp]
+	w.Emit(trace.EvGoStartLocal, 1, 10)
+	w.Emit(trace.EvGoEnd, 1)
+
+	useTrace(t, w, s)
+
+	p := getProfile(t, pprofSched, "/sched")
+	got := make(map[string]int64)
+	for _, s := range p.Sample {
+		got[strings.Join(s.Label["reason"], ",")] += s.Value[1]
+	}
+	want := map[string]int64{"create": 5e9, "unblock": 2e9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got delays by reason %v, want %v", got, want)
+	}
+}
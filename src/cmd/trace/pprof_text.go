@@ -0,0 +1,159 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// In-process rendering of pprof-like profiles as text.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// renderText writes a listing of the functions in p to w, sorted by the
+// value with the given index of the samples in which they are the leaf
+// function (flat), like the top command of go tool pprof.
+func renderText(w io.Writer, p *profile.Profile, index int) error {
+	if index < 0 || index >= len(p.SampleType) {
+		return fmt.Errorf("sample index %d out of range", index)
+	}
+	unit := p.SampleType[index].Unit
+	type item struct {
+		name      string
+		flat, cum int64
+	}
+	items := make(map[string]*item)
+	var total int64
+	for _, s := range p.Sample {
+		v := s.Value[index]
+		total += v
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			name := locationName(loc)
+			it := items[name]
+			if it == nil {
+				it = &item{name: name}
+				items[name] = it
+			}
+			if i == 0 {
+				it.flat += v
+			}
+			if !seen[name] {
+				seen[name] = true
+				it.cum += v
+			}
+		}
+	}
+	list := make([]*item, 0, len(items))
+	for _, it := range items {
+		list = append(list, it)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].flat != list[j].flat {
+			return list[i].flat > list[j].flat
+		}
+		if list[i].cum != list[j].cum {
+			return list[i].cum > list[j].cum
+		}
+		return list[i].name < list[j].name
+	})
+
+	fmt.Fprintf(w, "Type: %s\n", p.SampleType[index].Type)
+	fmt.Fprintf(w, "Total: %s\n", formatValue(total, unit))
+	fmt.Fprintf(w, "%10s %6s %6s %10s %6s\n", "flat", "flat%", "sum%", "cum", "cum%")
+	var sum int64
+	for _, it := range list {
+		sum += it.flat
+		fmt.Fprintf(w, "%10s %6s %6s %10s %6s  %s\n",
+			formatValue(it.flat, unit), percentage(it.flat, total), percentage(sum, total),
+			formatValue(it.cum, unit), percentage(it.cum, total), it.name)
+	}
+	return nil
+}
+
+// renderTraces writes the samples of p to w, with their labels, their
+// value with the given index, and their stacks, like the traces command
+// of go tool pprof. Samples are sorted by decreasing value.
+func renderTraces(w io.Writer, p *profile.Profile, index int) error {
+	if index < 0 || index >= len(p.SampleType) {
+		return fmt.Errorf("sample index %d out of range", index)
+	}
+	unit := p.SampleType[index].Unit
+	samples := make([]*profile.Sample, len(p.Sample))
+	copy(samples, p.Sample)
+	stacks := make(map[*profile.Sample]string)
+	for _, s := range samples {
+		var names []string
+		for _, loc := range s.Location {
+			names = append(names, locationName(loc))
+		}
+		stacks[s] = strings.Join(names, "\n")
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if vi, vj := samples[i].Value[index], samples[j].Value[index]; vi != vj {
+			return vi > vj
+		}
+		return stacks[samples[i]] < stacks[samples[j]]
+	})
+
+	const separator = "-----------+-------------------------------------------------------"
+	fmt.Fprintf(w, "Type: %s\n", p.SampleType[index].Type)
+	for _, s := range samples {
+		fmt.Fprintln(w, separator)
+		var keys []string
+		for k := range s.Label {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%10s:  %s\n", k, strings.Join(s.Label[k], " "))
+		}
+		value := formatValue(s.Value[index], unit)
+		for i, name := range strings.Split(stacks[s], "\n") {
+			fmt.Fprintf(w, "%10s   %s\n", value, name)
+			if i == 0 {
+				value = ""
+			}
+		}
+	}
+	fmt.Fprintln(w, separator)
+	return nil
+}
+
+// locationName returns the name of the function of loc.
+func locationName(loc *profile.Location) string {
+	if len(loc.Line) == 0 || loc.Line[0].Function == nil {
+		return fmt.Sprintf("%#x", loc.Address)
+	}
+	return loc.Line[0].Function.Name
+}
+
+// formatValue formats the sample value v, measured in unit.
+func formatValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).String()
+	case "bytes":
+		return strconv.FormatInt(v, 10) + "B"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// percentage formats v as a percentage of total.
+func percentage(v, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	ratio := 100 * float64(v) / float64(total)
+	if ratio >= 99.995 {
+		return "100%"
+	}
+	return fmt.Sprintf("%.2f%%", ratio)
+}
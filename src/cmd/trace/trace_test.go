@@ -15,13 +15,15 @@ type stacks map[uint64][]*trace.Frame
 
 // add adds a stack with a single frame whose Fn field is
 // set to the provided fname and returns a unique stack id.
+// The frame's PC is set to the stack id, so that distinct
+// stacks map to distinct profile locations.
 func (s *stacks) add(fname string) uint64 {
 	if *s == nil {
 		*s = make(map[uint64][]*trace.Frame)
 	}
 
-	id := uint64(len(*s))
-	(*s)[id] = []*trace.Frame{{Fn: fname}}
+	id := uint64(len(*s) + 1)
+	(*s)[id] = []*trace.Frame{{PC: id, Fn: fname}}
 	return id
 }
 
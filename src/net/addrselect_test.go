@@ -7,6 +7,7 @@
 package net
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -247,3 +248,70 @@ func TestRFC6724CommonPrefixLength(t *testing.T) {
 	}
 
 }
+
+func TestLookupIPAddrSorted(t *testing.T) {
+	if !supportsIPv4() || !supportsIPv6() {
+		t.Skip("both IPv4 and IPv6 are required")
+	}
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		return []IPAddr{
+			{IP: ParseIP("fe80::1")}, // link-local without a zone is unusable
+			{IP: IPv4(127, 0, 0, 1)},
+			{IP: IPv6loopback},
+		}, nil
+	}
+
+	addrs, err := DefaultResolver.LookupIPAddrSorted(context.Background(), "mixed.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IPAddr{
+		{IP: IPv6loopback},
+		{IP: IPv4(127, 0, 0, 1)},
+		{IP: ParseIP("fe80::1")},
+	}
+	if !reflect.DeepEqual(addrs, want) {
+		t.Errorf("got %v; want %v", addrs, want)
+	}
+}
+
+func TestLookupIPAddrStatus(t *testing.T) {
+	origTestHookLookupIP := testHookLookupIP
+	origTestHookSrcAddrs := testHookSrcAddrs
+	defer func() {
+		testHookLookupIP = origTestHookLookupIP
+		testHookSrcAddrs = origTestHookSrcAddrs
+	}()
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		return []IPAddr{
+			{IP: ParseIP("2001:db8::1")},
+			{IP: ParseIP("192.0.2.1")},
+			{IP: ParseIP("2001:db8::2")},
+		}, nil
+	}
+	// Simulate a host with only an IPv4 source address.
+	testHookSrcAddrs = func(addrs []IPAddr) []IP {
+		srcs := make([]IP, len(addrs))
+		for i, addr := range addrs {
+			if addr.IP.To4() != nil {
+				srcs[i] = ParseIP("192.0.2.100")
+			}
+		}
+		return srcs
+	}
+
+	got, err := DefaultResolver.LookupIPAddrStatus(context.Background(), "mixed.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IPAddrStatus{
+		{IPAddr: IPAddr{IP: ParseIP("192.0.2.1")}, Reachable: true},
+		{IPAddr: IPAddr{IP: ParseIP("2001:db8::1")}, Reachable: false},
+		{IPAddr: IPAddr{IP: ParseIP("2001:db8::2")}, Reachable: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"internal/nettrace"
 	"internal/poll"
+	"math/rand"
 	"time"
 )
 
@@ -53,8 +54,20 @@ type Dialer struct {
 	// FallbackDelay specifies the length of time to wait before
 	// spawning a fallback connection, when DualStack is enabled.
 	// If zero, a default delay of 300ms is used.
+	// A negative value disables the fallback: the addresses of
+	// both families are then dialed one at a time, the primary
+	// ones first.
 	FallbackDelay time.Duration
 
+	// PreferFamily optionally specifies the address family to try
+	// first when the host in the address parameter resolves to
+	// both IPv4 and IPv6 addresses: "ip4" or "ip6". With
+	// DualStack, the preferred family is the primary one, and the
+	// other is the fallback.
+	// If empty, the addresses are tried in the order the
+	// resolver returns them.
+	PreferFamily string
+
 	// KeepAlive specifies the keep-alive period for an active
 	// network connection.
 	// If zero, keep-alives are not enabled. Network protocols
@@ -64,6 +77,43 @@ type Dialer struct {
 	// Resolver optionally specifies an alternate resolver to use.
 	Resolver *Resolver
 
+	// SelectConn optionally specifies a probe that is run on each
+	// newly established connection before the dial returns it.
+	// If SelectConn reports false or returns an error, the
+	// connection is closed and the next address is tried, as if
+	// the connection had failed. The first connection that passes
+	// the probe is returned.
+	SelectConn func(ctx context.Context, c Conn) (ok bool, err error)
+
+	// DialTCP optionally specifies a function that establishes
+	// each TCP connection in place of the operating system, for
+	// instance to inject failures or delays in tests. It is called
+	// with the network and the local and remote addresses of each
+	// attempt, after name resolution. It must return either a
+	// connection or an error. An *OpError, such as those returned
+	// by DialTCP and Dialer.DialContext, is returned by the dial
+	// as is; other errors are wrapped in an *OpError.
+	// If nil, the connection is dialed normally.
+	DialTCP func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error)
+
+	// ReserveForTLS is the portion of the dial's deadline to
+	// leave for a TLS handshake following the dial. Resolving
+	// and connecting must complete that long before the
+	// deadline, or the dial fails with ErrTLSReserve.
+	// It has no effect if the dial has no deadline.
+	ReserveForTLS time.Duration
+
+	// Retry optionally specifies how to retry dials that fail
+	// with a transient error, such as a refused connection or a
+	// timeout. Each retry resolves the address again. Retries
+	// are made only within the dial's deadline.
+	// If Retry.Max is zero, failed dials are not retried.
+	Retry DialRetry
+
+	// Trace optionally specifies functions called as the
+	// addresses the dial resolved to are tried.
+	Trace DialTrace
+
 	// Cancel is an optional channel whose closure indicates that
 	// the dial should be canceled. Not all types of dials support
 	// cancelation.
@@ -72,6 +122,72 @@ type Dialer struct {
 	Cancel <-chan struct{}
 }
 
+// DialTrace specifies functions called as a Dialer tries the
+// addresses a dial resolved to. Any of them may be nil.
+//
+// With DualStack, DialAttempt and DialFailure may be called
+// concurrently for the primary and fallback addresses.
+type DialTrace struct {
+	// DialAttempt is called when a connection to addr on the
+	// named network is attempted.
+	DialAttempt func(network string, addr Addr)
+
+	// DialFailure is called when the attempted connection to
+	// addr fails, or is rejected by SelectConn, with the error.
+	DialFailure func(addr Addr, err error)
+
+	// DialSuccess is called once, with the local and remote
+	// addresses of the connection the dial returns. With DualStack,
+	// it is not called for a connection that lost the race to
+	// another address.
+	DialSuccess func(laddr, raddr Addr)
+}
+
+// DialRetry specifies how a Dialer retries failed dials.
+type DialRetry struct {
+	// Max is the maximum number of retries after the first
+	// attempt.
+	Max int
+
+	// Backoff is the time to wait before each retry.
+	Backoff time.Duration
+
+	// Jitter is the upper bound of a random duration added to
+	// Backoff, so that many clients retrying at the same time
+	// do not all dial at once.
+	Jitter time.Duration
+}
+
+// wait waits before a retry. It reports whether the wait completed
+// before ctx was done.
+func (r *DialRetry) wait(ctx context.Context) bool {
+	d := r.Backoff
+	if r.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(r.Jitter)))
+	}
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isTransientDialError reports whether err, returned by a dial,
+// may go away if the dial is retried.
+func isTransientDialError(err error) bool {
+	oe, ok := err.(*OpError)
+	if !ok {
+		return false
+	}
+	return oe.Timeout() || isConnRefused(oe.Err)
+}
+
 func minNonzeroTime(a, b time.Time) time.Time {
 	if a.IsZero() {
 		return b
@@ -342,6 +458,11 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 	if ctx == nil {
 		panic("nil context")
 	}
+	switch d.PreferFamily {
+	case "", "ip4", "ip6":
+	default:
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: UnknownNetworkError(d.PreferFamily)}
+	}
 	deadline := d.deadline(ctx, time.Now())
 	if !deadline.IsZero() {
 		if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
@@ -363,6 +484,18 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 		ctx = subCtx
 	}
 
+	var tlsCtx context.Context // ctx including the time reserved for TLS
+	if d.ReserveForTLS > 0 && !deadline.IsZero() {
+		connectDeadline := deadline.Add(-d.ReserveForTLS)
+		if !time.Now().Before(connectDeadline) {
+			return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: ErrTLSReserve}
+		}
+		tlsCtx = ctx
+		subCtx, cancel := context.WithDeadline(ctx, connectDeadline)
+		defer cancel()
+		ctx = subCtx
+	}
+
 	// Shadow the nettrace (if any) during resolve so Connect events don't fire for DNS lookups.
 	resolveCtx := ctx
 	if trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace); trace != nil {
@@ -372,10 +505,41 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 		resolveCtx = context.WithValue(resolveCtx, nettrace.TraceKey{}, &shadow)
 	}
 
+	var err error
+	for retries := 0; ; retries++ {
+		var c Conn
+		c, err = d.dial(ctx, resolveCtx, network, address)
+		if err == nil {
+			return c, nil
+		}
+		if retries >= d.Retry.Max || ctx.Err() != nil || !isTransientDialError(err) {
+			break
+		}
+		if !d.Retry.wait(ctx) {
+			break
+		}
+	}
+	if tlsCtx != nil && ctx.Err() == context.DeadlineExceeded && tlsCtx.Err() == nil {
+		if oe, ok := err.(*OpError); ok {
+			oe.Err = ErrTLSReserve
+		}
+	}
+	return nil, err
+}
+
+// dial makes a single attempt to resolve address and connect to it.
+// Name resolution uses resolveCtx.
+func (d *Dialer) dial(ctx, resolveCtx context.Context, network, address string) (Conn, error) {
 	addrs, err := d.resolver().resolveAddrList(resolveCtx, "dial", network, address, d.LocalAddr)
 	if err != nil {
 		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
 	}
+	switch d.PreferFamily {
+	case "ip4":
+		addrs = addrs.prefer(isIPv4)
+	case "ip6":
+		addrs = addrs.prefer(isNotIPv4)
+	}
 
 	dp := &dialParam{
 		Dialer:  *d,
@@ -399,6 +563,9 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 	if err != nil {
 		return nil, err
 	}
+	if d.Trace.DialSuccess != nil {
+		d.Trace.DialSuccess(c.LocalAddr(), c.RemoteAddr())
+	}
 
 	if tc, ok := c.(*TCPConn); ok && d.KeepAlive > 0 {
 		setKeepAlive(tc.fd, true)
@@ -412,10 +579,17 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn
 // head start. It returns the first established connection and
 // closes the others. Otherwise it returns an error from the first
 // primary address.
+// If dp.FallbackDelay is negative, it dials the primaries and then the
+// fallbacks in sequence instead.
 func dialParallel(ctx context.Context, dp *dialParam, primaries, fallbacks addrList) (Conn, error) {
 	if len(fallbacks) == 0 {
 		return dialSerial(ctx, dp, primaries)
 	}
+	if dp.FallbackDelay < 0 {
+		ras := make(addrList, 0, len(primaries)+len(fallbacks))
+		ras = append(append(ras, primaries...), fallbacks...)
+		return dialSerial(ctx, dp, ras)
+	}
 
 	returned := make(chan struct{})
 	defer close(returned)
@@ -512,10 +686,19 @@ func dialSerial(ctx context.Context, dp *dialParam, ras addrList) (Conn, error)
 			defer cancel()
 		}
 
+		if dp.Trace.DialAttempt != nil {
+			dp.Trace.DialAttempt(dp.network, ra)
+		}
 		c, err := dialSingle(dialCtx, dp, ra)
+		if err == nil && dp.SelectConn != nil {
+			err = selectConn(dialCtx, dp, ra, c)
+		}
 		if err == nil {
 			return c, nil
 		}
+		if dp.Trace.DialFailure != nil {
+			dp.Trace.DialFailure(ra, err)
+		}
 		if firstErr == nil {
 			firstErr = err
 		}
@@ -527,6 +710,21 @@ func dialSerial(ctx context.Context, dp *dialParam, ras addrList) (Conn, error)
 	return nil, firstErr
 }
 
+// selectConn runs the SelectConn probe on c, a connection to ra.
+// If c does not pass the probe, selectConn closes it and returns
+// an error.
+func selectConn(ctx context.Context, dp *dialParam, ra Addr, c Conn) error {
+	ok, err := dp.SelectConn(ctx, c)
+	if ok && err == nil {
+		return nil
+	}
+	c.Close()
+	if err == nil {
+		err = errConnRejected
+	}
+	return &OpError{Op: "dial", Net: dp.network, Source: c.LocalAddr(), Addr: ra, Err: err}
+}
+
 // dialSingle attempts to establish and returns a single connection to
 // the destination address.
 func dialSingle(ctx context.Context, dp *dialParam, ra Addr) (c Conn, err error) {
@@ -544,6 +742,9 @@ func dialSingle(ctx context.Context, dp *dialParam, ra Addr) (c Conn, err error)
 	switch ra := ra.(type) {
 	case *TCPAddr:
 		la, _ := la.(*TCPAddr)
+		if dp.DialTCP != nil {
+			return dialTCPHook(ctx, dp, la, ra)
+		}
 		c, err = dialTCP(ctx, dp.network, la, ra)
 	case *UDPAddr:
 		la, _ := la.(*UDPAddr)
@@ -563,6 +764,23 @@ func dialSingle(ctx context.Context, dp *dialParam, ra Addr) (c Conn, err error)
 	return c, nil
 }
 
+// dialTCPHook dials ra with dp.DialTCP. An *OpError it returns, as
+// DialTCP and Dialer.DialContext do, is returned unchanged, so that
+// the error it wraps can be examined; other errors are wrapped in one.
+func dialTCPHook(ctx context.Context, dp *dialParam, la, ra *TCPAddr) (Conn, error) {
+	c, err := dp.DialTCP(ctx, dp.network, la, ra)
+	if err == nil && c == nil {
+		err = errNoTCPConn
+	}
+	if err != nil {
+		if _, ok := err.(*OpError); ok {
+			return nil, err
+		}
+		return nil, &OpError{Op: "dial", Net: dp.network, Source: dp.LocalAddr, Addr: ra, Err: err}
+	}
+	return c, nil
+}
+
 // Listen announces on the local network address.
 //
 // The network must be "tcp", "tcp4", "tcp6", "unix" or "unixpacket".
@@ -7,11 +7,14 @@ package net
 import (
 	"bufio"
 	"context"
+	"errors"
 	"internal/poll"
 	"internal/testenv"
 	"io"
 	"os"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -498,6 +501,501 @@ func TestDialParallelSpuriousConnection(t *testing.T) {
 	wg.Wait()
 }
 
+func TestDialerSelectConn(t *testing.T) {
+	// Each server greets its clients with its name.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var addrs addrList
+	closed := make(chan string, 2)
+	for _, name := range []string{"first", "second"} {
+		ln, err := newLocalListener("tcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		addrs = append(addrs, ln.Addr())
+		wg.Add(1)
+		go func(ln Listener, name string) {
+			defer wg.Done()
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			c.Write([]byte(name + "\n"))
+			c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := c.Read(make([]byte, 1)); err == io.EOF {
+				closed <- name
+			}
+		}(ln, name)
+	}
+
+	var probed []string
+	d := Dialer{
+		SelectConn: func(ctx context.Context, c Conn) (bool, error) {
+			greeting, err := bufio.NewReader(c).ReadString('\n')
+			if err != nil {
+				return false, err
+			}
+			probed = append(probed, greeting)
+			return greeting == "second\n", nil
+		},
+	}
+	dp := &dialParam{
+		Dialer:  d,
+		network: "tcp",
+		address: "?",
+	}
+	c, err := dialSerial(context.Background(), dp, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got, want := c.RemoteAddr().String(), addrs[1].String(); got != want {
+		t.Errorf("got connection to %v; want %v", got, want)
+	}
+	if len(probed) != 2 {
+		t.Errorf("probed %q; want both servers", probed)
+	}
+	if name := <-closed; name != "first" {
+		t.Errorf("connection to %s server closed; want first", name)
+	}
+
+	// A dial fails if no connection passes the probe.
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	d.SelectConn = func(ctx context.Context, c Conn) (bool, error) {
+		return false, nil
+	}
+	c, err = d.Dial("tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if perr := parseDialError(err); perr != nil {
+		t.Error(perr)
+	}
+	if err, ok := err.(*OpError); !ok || err.Err != errConnRejected {
+		t.Errorf("got %v; want %v", err, errConnRejected)
+	}
+}
+
+func TestDialerDialTCP(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	// A hook returning a canned connection replaces the dial.
+	target := ln.Addr().(*TCPAddr)
+	var dialed []string
+	d := Dialer{
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			dialed = append(dialed, raddr.String())
+			return DialTCP(network, laddr, target)
+		},
+	}
+	c, err := d.Dial("tcp", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if len(dialed) != 1 || dialed[0] != "127.0.0.1:1" {
+		t.Errorf("hook dialed %q; want [127.0.0.1:1]", dialed)
+	}
+	if got, want := c.RemoteAddr().String(), target.String(); got != want {
+		t.Errorf("got connection to %v; want %v", got, want)
+	}
+
+	// A hook returning an error fails the dial.
+	errInjected := errors.New("injected dial failure")
+	d.DialTCP = func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		return nil, errInjected
+	}
+	c, err = d.Dial("tcp", target.String())
+	if err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Err != errInjected {
+		t.Errorf("got %v; want %v", err, errInjected)
+	}
+
+	// A hook returning an *OpError fails the dial with it as is.
+	opErr := &OpError{Op: "dial", Net: "tcp", Addr: target, Err: errInjected}
+	d.DialTCP = func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		return nil, opErr
+	}
+	c, err = d.Dial("tcp", target.String())
+	if err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if err != opErr {
+		t.Errorf("got %v; want %v", err, opErr)
+	}
+
+	// A hook returning neither a connection nor an error fails the dial.
+	d.DialTCP = func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		return nil, nil
+	}
+	c, err = d.Dial("tcp", target.String())
+	if err == nil {
+		t.Fatalf("got connection %v; want error", c)
+	}
+	if c != nil {
+		t.Errorf("got connection %v with error %v; want nil", c, err)
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Err != errNoTCPConn {
+		t.Errorf("got %v; want %v", err, errNoTCPConn)
+	}
+}
+
+func TestDialParallelFallbackDelay(t *testing.T) {
+	primaries := addrList{&TCPAddr{IP: ParseIP("192.0.2.1"), Port: 80}}
+	fallbacks := addrList{&TCPAddr{IP: ParseIP("2001:db8::1"), Port: 80}}
+	isPrimary := func(raddr *TCPAddr) bool { return raddr.IP.To4() != nil }
+
+	// The fallback is attempted once the delay elapses, while the
+	// primary is still pending.
+	const delay = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fallbackStart time.Duration
+	start := time.Now()
+	dp := &dialParam{
+		Dialer: Dialer{
+			FallbackDelay: delay,
+			DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+				if isPrimary(raddr) {
+					<-ctx.Done()
+					return nil, mapErr(ctx.Err())
+				}
+				fallbackStart = time.Since(start)
+				cancel()
+				return nil, errConnRejected
+			},
+		},
+		network: "tcp",
+		address: "?",
+	}
+	if c, err := dialParallel(ctx, dp, primaries, fallbacks); err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if fallbackStart < delay {
+		t.Errorf("fallback attempted after %v; want at least %v", fallbackStart, delay)
+	}
+
+	// With a negative delay, the fallback is attempted only after
+	// the primary fails.
+	var dialed []string
+	dp.FallbackDelay = -1
+	dp.DialTCP = func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		dialed = append(dialed, raddr.String())
+		if isPrimary(raddr) {
+			time.Sleep(delay)
+		}
+		return nil, errConnRejected
+	}
+	if c, err := dialParallel(context.Background(), dp, primaries, fallbacks); err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if want := []string{"192.0.2.1:80", "[2001:db8::1]:80"}; !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %q; want %q", dialed, want)
+	}
+
+	// Nor is it attempted while the primary is pending.
+	dialed = nil
+	dp.DialTCP = func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		dialed = append(dialed, raddr.String())
+		<-ctx.Done()
+		return nil, mapErr(ctx.Err())
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 3*delay)
+	defer cancel()
+	if c, err := dialParallel(ctx, dp, primaries, fallbacks); err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if want := []string{"192.0.2.1:80"}; !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %q; want %q", dialed, want)
+	}
+}
+
+func TestDialerPreferFamily(t *testing.T) {
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		return []IPAddr{
+			{IP: ParseIP("2001:db8::1")},
+			{IP: ParseIP("192.0.2.1")},
+			{IP: ParseIP("2001:db8::2")},
+			{IP: ParseIP("192.0.2.2")},
+		}, nil
+	}
+
+	for _, tt := range []struct {
+		prefer    string
+		dualStack bool
+		want      []string
+	}{
+		{"", false, []string{"[2001:db8::1]:80", "192.0.2.1:80", "[2001:db8::2]:80", "192.0.2.2:80"}},
+		{"ip4", false, []string{"192.0.2.1:80", "192.0.2.2:80", "[2001:db8::1]:80", "[2001:db8::2]:80"}},
+		{"ip6", false, []string{"[2001:db8::1]:80", "[2001:db8::2]:80", "192.0.2.1:80", "192.0.2.2:80"}},
+		{"", true, []string{"[2001:db8::1]:80", "[2001:db8::2]:80", "192.0.2.1:80", "192.0.2.2:80"}},
+		{"ip4", true, []string{"192.0.2.1:80", "192.0.2.2:80", "[2001:db8::1]:80", "[2001:db8::2]:80"}},
+		{"ip6", true, []string{"[2001:db8::1]:80", "[2001:db8::2]:80", "192.0.2.1:80", "192.0.2.2:80"}},
+	} {
+		var mu sync.Mutex
+		var dialed []string
+		d := Dialer{
+			DualStack:    tt.dualStack,
+			PreferFamily: tt.prefer,
+			DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+				mu.Lock()
+				dialed = append(dialed, raddr.String())
+				mu.Unlock()
+				return nil, errConnRejected
+			},
+		}
+		// With DualStack, the fallback family is dialed as soon as
+		// the primary one fails, so the attempts stay ordered.
+		if c, err := d.Dial("tcp", "dualstack.example:80"); err == nil {
+			c.Close()
+			t.Errorf("prefer=%q dualStack=%v: got connection; want error", tt.prefer, tt.dualStack)
+			continue
+		}
+		if !reflect.DeepEqual(dialed, tt.want) {
+			t.Errorf("prefer=%q dualStack=%v: dialed %q; want %q", tt.prefer, tt.dualStack, dialed, tt.want)
+		}
+	}
+
+	// An unknown family fails the dial before any lookup or
+	// connection attempt, and is not retried.
+	lookups, dials := 0, 0
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		lookups++
+		return []IPAddr{{IP: ParseIP("192.0.2.1")}}, nil
+	}
+	d := Dialer{
+		PreferFamily: "ip5",
+		Retry:        DialRetry{Max: 2, Backoff: time.Millisecond},
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			dials++
+			return nil, errConnRejected
+		},
+	}
+	if c, err := d.Dial("tcp", "dualstack.example:80"); err == nil {
+		c.Close()
+		t.Error("PreferFamily=ip5: got connection; want error")
+	} else if oe, ok := err.(*OpError); !ok || oe.Err != UnknownNetworkError("ip5") {
+		t.Errorf("PreferFamily=ip5: got %v; want %v", err, UnknownNetworkError("ip5"))
+	}
+	if lookups != 0 || dials != 0 {
+		t.Errorf("PreferFamily=ip5: got %d lookups and %d dials; want none", lookups, dials)
+	}
+}
+
+func TestDialerTrace(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		return []IPAddr{
+			{IP: ParseIP("192.0.2.1")},
+			{IP: ParseIP("192.0.2.2")},
+			{IP: ParseIP("192.0.2.3")},
+		}, nil
+	}
+
+	// The first two addresses fail, and the third one is
+	// connected to the listener.
+	target := ln.Addr().(*TCPAddr)
+	errInjected := errors.New("injected dial failure")
+	var events []string
+	d := Dialer{
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			if raddr.IP.Equal(ParseIP("192.0.2.3")) {
+				return DialTCP(network, laddr, target)
+			}
+			return nil, errInjected
+		},
+		Trace: DialTrace{
+			DialAttempt: func(network string, addr Addr) {
+				events = append(events, "attempt "+network+" "+addr.String())
+			},
+			DialFailure: func(addr Addr, err error) {
+				if oe, ok := err.(*OpError); !ok || oe.Err != errInjected {
+					t.Errorf("DialFailure(%v) got error %v; want %v", addr, err, errInjected)
+				}
+				events = append(events, "failure "+addr.String())
+			},
+			DialSuccess: func(laddr, raddr Addr) {
+				events = append(events, "success "+raddr.String())
+			},
+		},
+	}
+	c, err := d.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	want := []string{
+		"attempt tcp 192.0.2.1:80",
+		"failure 192.0.2.1:80",
+		"attempt tcp 192.0.2.2:80",
+		"failure 192.0.2.2:80",
+		"attempt tcp 192.0.2.3:80",
+		"success " + target.String(),
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got trace events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDialerTraceDualStack(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var closed sync.WaitGroup
+	closed.Add(2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer closed.Done()
+				defer c.Close()
+				// The dialers never write, so Read returns
+				// once they close their connection.
+				c.Read(make([]byte, 1))
+			}()
+		}
+	}()
+
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		return []IPAddr{
+			{IP: ParseIP("192.0.2.1")},
+			{IP: ParseIP("2001:db8::1")},
+		}, nil
+	}
+
+	// Both racers connect to the listener, and neither returns
+	// before the other has connected, so that dialParallel closes
+	// the connection of the racer that loses.
+	target := ln.Addr().(*TCPAddr)
+	var connected sync.WaitGroup
+	connected.Add(2)
+	var mu sync.Mutex
+	var successes []string
+	d := Dialer{
+		DualStack:     true,
+		FallbackDelay: time.Millisecond,
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			c, err := DialTCP("tcp", laddr, target)
+			connected.Done()
+			connected.Wait()
+			return c, err
+		},
+		Trace: DialTrace{
+			DialSuccess: func(laddr, raddr Addr) {
+				mu.Lock()
+				successes = append(successes, laddr.String())
+				mu.Unlock()
+			},
+		},
+	}
+	c, err := d.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	// Wait for both connections to be closed, the losing one by
+	// dialParallel.
+	closed.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{c.LocalAddr().String()}; !reflect.DeepEqual(successes, want) {
+		t.Errorf("DialSuccess called for %v; want only %v", successes, want)
+	}
+}
+
+func TestDialerReserveForTLS(t *testing.T) {
+	origTestHookDialTCP := testHookDialTCP
+	defer func() { testHookDialTCP = origTestHookDialTCP }()
+	testHookDialTCP = func(ctx context.Context, net string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		<-ctx.Done()
+		return nil, mapErr(ctx.Err())
+	}
+
+	for _, tt := range []struct {
+		timeout, reserve time.Duration
+		max              time.Duration // maximum expected dial duration
+	}{
+		{timeout: 2 * time.Second, reserve: 1900 * time.Millisecond, max: 1 * time.Second},
+		{timeout: 100 * time.Millisecond, reserve: 100 * time.Millisecond, max: 50 * time.Millisecond},
+		{timeout: 100 * time.Millisecond, reserve: time.Second, max: 50 * time.Millisecond},
+	} {
+		d := Dialer{Timeout: tt.timeout, ReserveForTLS: tt.reserve}
+		start := time.Now()
+		c, err := d.Dial("tcp", "127.0.0.1:0")
+		elapsed := time.Since(start)
+		if err == nil {
+			c.Close()
+			t.Errorf("timeout=%v reserve=%v: got connection; want error", tt.timeout, tt.reserve)
+			continue
+		}
+		if perr := parseDialError(err); perr != nil {
+			t.Error(perr)
+		}
+		if oe, ok := err.(*OpError); !ok || oe.Err != ErrTLSReserve {
+			t.Errorf("timeout=%v reserve=%v: got %v; want %v", tt.timeout, tt.reserve, err, ErrTLSReserve)
+		}
+		if nerr, ok := err.(Error); !ok || !nerr.Timeout() {
+			t.Errorf("timeout=%v reserve=%v: got %v; want timeout error", tt.timeout, tt.reserve, err)
+		}
+		if elapsed > tt.max {
+			t.Errorf("timeout=%v reserve=%v: dial took %v; want at most %v", tt.timeout, tt.reserve, elapsed, tt.max)
+		}
+	}
+}
+
 func TestDialerPartialDeadline(t *testing.T) {
 	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
 	var testCases = []struct {
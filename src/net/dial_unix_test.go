@@ -8,6 +8,7 @@ package net
 
 import (
 	"context"
+	"os"
 	"syscall"
 	"testing"
 	"time"
@@ -106,3 +107,127 @@ func TestDialContextCancelRace(t *testing.T) {
 		t.Errorf("DialContext = (%v, %v); want OpError with error %v", c, err, ctx.Err())
 	}
 }
+
+func TestDialerRetry(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	origTestHookDialTCP := testHookDialTCP
+	defer func() { testHookDialTCP = origTestHookDialTCP }()
+
+	for _, tt := range []struct {
+		dialErr error // error returned by the refused dials
+		retries int
+		dials   int // number of dials made
+		ok      bool
+	}{
+		{syscall.ECONNREFUSED, 2, 3, true},
+		{syscall.ECONNREFUSED, 1, 2, false},
+		{syscall.ECONNREFUSED, 0, 1, false},
+		{syscall.EACCES, 2, 1, false},
+	} {
+		dials := 0
+		testHookDialTCP = func(ctx context.Context, net string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			dials++
+			if dials <= 2 {
+				return nil, os.NewSyscallError("connect", tt.dialErr)
+			}
+			return doDialTCP(ctx, net, laddr, raddr)
+		}
+		d := Dialer{
+			Timeout: 5 * time.Second,
+			Retry: DialRetry{
+				Max:     tt.retries,
+				Backoff: 10 * time.Millisecond,
+				Jitter:  10 * time.Millisecond,
+			},
+		}
+		c, err := d.Dial("tcp", ln.Addr().String())
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%v with %d retries: %v", tt.dialErr, tt.retries, err)
+			} else {
+				c.Close()
+			}
+		} else if err == nil {
+			c.Close()
+			t.Errorf("%v with %d retries: got connection; want error", tt.dialErr, tt.retries)
+		}
+		if dials != tt.dials {
+			t.Errorf("%v with %d retries: got %d dials; want %d", tt.dialErr, tt.retries, dials, tt.dials)
+		}
+	}
+}
+
+func TestDialerRetryDialTCP(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	// A refused dial reported by a Dialer.DialTCP hook as an
+	// *OpError is retried like one made by the dialer itself.
+	dials := 0
+	d := Dialer{
+		Timeout: 5 * time.Second,
+		Retry:   DialRetry{Max: 2, Backoff: 10 * time.Millisecond},
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			dials++
+			if dials <= 2 {
+				return nil, &OpError{Op: "dial", Net: network, Addr: raddr, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+			}
+			return DialTCP(network, laddr, raddr)
+		},
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if dials != 3 {
+		t.Errorf("got %d dials; want 3", dials)
+	}
+}
+
+func TestDialerRetryDeadline(t *testing.T) {
+	origTestHookDialTCP := testHookDialTCP
+	defer func() { testHookDialTCP = origTestHookDialTCP }()
+	testHookDialTCP = func(ctx context.Context, net string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+		return nil, os.NewSyscallError("connect", syscall.ECONNREFUSED)
+	}
+
+	d := Dialer{
+		Timeout: 100 * time.Millisecond,
+		Retry:   DialRetry{Max: 1000, Backoff: 10 * time.Millisecond},
+	}
+	start := time.Now()
+	if c, err := d.Dial("tcp", "127.0.0.1:0"); err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retries took %v; want them to stop at the dial deadline", elapsed)
+	}
+}
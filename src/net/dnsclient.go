@@ -7,6 +7,8 @@ package net
 import (
 	"math/rand"
 	"sort"
+	"sync"
+	"time"
 )
 
 // reverseaddr returns the in-addr.arpa. or ip6.arpa. hostname of the IP
@@ -271,3 +273,157 @@ func (s byPref) sort() {
 type NS struct {
 	Host string
 }
+
+// maxNegativeCacheEntries is the maximum number of names
+// held by a dnsNegativeCache.
+const maxNegativeCacheEntries = 1000
+
+// A dnsNegativeCache holds names that DNS servers reported
+// as nonexistent, until their negative caching TTL expires.
+type dnsNegativeCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time // keyed by rooted name
+}
+
+// lookup reports whether name is in the cache and has not expired,
+// and if so, the time left until it expires.
+func (c *dnsNegativeCache) lookup(name string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exp, ok := c.expires[name]
+	if !ok {
+		return 0, false
+	}
+	if ttl := time.Until(exp); ttl > 0 {
+		return ttl, true
+	}
+	delete(c.expires, name)
+	return 0, false
+}
+
+// add adds name to the cache for ttl.
+func (c *dnsNegativeCache) add(name string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expires == nil {
+		c.expires = make(map[string]time.Time)
+	}
+	if len(c.expires) >= maxNegativeCacheEntries {
+		for n, exp := range c.expires {
+			if !now.Before(exp) {
+				delete(c.expires, n)
+			}
+		}
+		if len(c.expires) >= maxNegativeCacheEntries {
+			return
+		}
+	}
+	c.expires[name] = now.Add(ttl)
+}
+
+// defaultCacheSize is the maximum number of names held by the
+// dnsAnswerCache of a Resolver without a CacheSize.
+const defaultCacheSize = 1000
+
+// A dnsAnswerCache holds the answers to address lookups until they
+// expire. Lookups query both address families, so the answers for
+// a name hold the addresses of both.
+type dnsAnswerCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsAnswer // keyed by host name
+}
+
+// A dnsAnswer is the cached answer to the lookup of a name: either
+// its addresses, or an error reporting that it does not exist.
+type dnsAnswer struct {
+	addrs   []IPAddr
+	err     error
+	expires time.Time
+}
+
+// get returns the cached answer for name, and reports whether there
+// is one that has not expired.
+func (c *dnsAnswerCache) get(name string) ([]IPAddr, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.entries[name]
+	if !ok {
+		return nil, nil, false
+	}
+	if !time.Now().Before(a.expires) {
+		delete(c.entries, name)
+		return nil, nil, false
+	}
+	if a.err != nil {
+		return nil, a.err, true
+	}
+	addrs := make([]IPAddr, len(a.addrs))
+	copy(addrs, a.addrs)
+	return addrs, nil, true
+}
+
+// add adds the answer for name to the cache for ttl. If the cache
+// holds size names, the one expiring first is evicted.
+func (c *dnsAnswerCache) add(name string, addrs []IPAddr, err error, ttl time.Duration, size int) {
+	if ttl <= 0 || size <= 0 {
+		return
+	}
+	a := dnsAnswer{err: err, expires: time.Now().Add(ttl)}
+	if err == nil {
+		a.addrs = make([]IPAddr, len(addrs))
+		copy(a.addrs, addrs)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]dnsAnswer)
+	}
+	if _, ok := c.entries[name]; !ok && len(c.entries) >= size {
+		var first string
+		for n, e := range c.entries {
+			if first == "" || e.expires.Before(c.entries[first].expires) {
+				first = n
+			}
+		}
+		delete(c.entries, first)
+	}
+	c.entries[name] = a
+}
+
+// dnsAnswerTTLKey is the context key for the dnsAnswerTTL of a
+// lookup whose answer is to be cached.
+type dnsAnswerTTLKey struct{}
+
+// A dnsAnswerTTL is the time for which the answer to a lookup may
+// be cached. The DNS client lowers it to the TTLs of the records it
+// receives, and to the negative caching TTLs of the responses
+// reporting that a name does not exist.
+type dnsAnswerTTL struct {
+	mu       sync.Mutex
+	ttl      time.Duration // for addresses
+	negative time.Duration // for an error reporting that the name does not exist
+}
+
+// observe lowers t to the least TTL of rrs.
+func (t *dnsAnswerTTL) observe(rrs []dnsRR) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, rr := range rrs {
+		if ttl := time.Duration(rr.Header().Ttl) * time.Second; ttl < t.ttl {
+			t.ttl = ttl
+		}
+	}
+}
+
+// observeNegative lowers the negative TTL of t to ttl.
+func (t *dnsAnswerTTL) observeNegative(ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ttl < t.negative {
+		t.negative = ttl
+	}
+}
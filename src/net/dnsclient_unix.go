@@ -150,6 +150,16 @@ func (r *Resolver) exchange(ctx context.Context, server, name string, qtype uint
 // Do a lookup for a single name, which must be rooted
 // (otherwise answer will not find the answers).
 func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string, qtype uint16) (string, []dnsRR, error) {
+	answerTTL, _ := ctx.Value(dnsAnswerTTLKey{}).(*dnsAnswerTTL)
+	if r.MaxNegativeTTL > 0 {
+		if ttl, ok := r.getCaches().negative.lookup(name); ok {
+			if answerTTL != nil {
+				answerTTL.observeNegative(ttl)
+			}
+			return "", nil, &DNSError{Err: errNoSuchHost.Error(), Name: name}
+		}
+	}
+
 	var lastErr error
 	serverOffset := cfg.serverOffset()
 	sLen := uint32(len(cfg.servers))
@@ -187,6 +197,20 @@ func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string,
 			// server probably won't help. Return now in those cases.
 			// TODO: indicate this in a more obvious way, such as a field on DNSError?
 			if err == nil || msg.rcode == dnsRcodeSuccess || msg.rcode == dnsRcodeNameError {
+				if msg.rcode == dnsRcodeNameError {
+					// Without an SOA record, ttl is 0, and the
+					// response is not cached.
+					ttl, _ := negativeTTL(msg)
+					if r.MaxNegativeTTL > 0 {
+						if ttl > r.MaxNegativeTTL {
+							ttl = r.MaxNegativeTTL
+						}
+						r.getCaches().negative.add(name, ttl)
+					}
+					if answerTTL != nil {
+						answerTTL.observeNegative(ttl)
+					}
+				}
 				return cname, rrs, err
 			}
 			lastErr = err
@@ -195,6 +219,22 @@ func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string,
 	return "", nil, lastErr
 }
 
+// negativeTTL returns the time for which the negative answer in msg
+// may be cached, as specified by RFC 2308, section 5. It reports false
+// if the authority section of msg holds no SOA record.
+func negativeTTL(msg *dnsMsg) (time.Duration, bool) {
+	for _, rr := range msg.ns {
+		if soa, ok := rr.(*dnsRR_SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			return time.Duration(ttl) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
 // addrRecordList converts and returns a list of IP addresses from DNS
 // address records (both A and AAAA). Other record types are ignored.
 func addrRecordList(rrs []dnsRR) []IPAddr {
@@ -417,7 +457,7 @@ func (r *Resolver) goLookupHost(ctx context.Context, name string) (addrs []strin
 func (r *Resolver) goLookupHostOrder(ctx context.Context, name string, order hostLookupOrder) (addrs []string, err error) {
 	if order == hostLookupFilesDNS || order == hostLookupFiles {
 		// Use entries from /etc/hosts if they match.
-		addrs = lookupStaticHost(name)
+		addrs = lookupStaticHost(r.hostsPath(), name)
 		if len(addrs) > 0 || order == hostLookupFiles {
 			return
 		}
@@ -433,9 +473,27 @@ func (r *Resolver) goLookupHostOrder(ctx context.Context, name string, order hos
 	return
 }
 
+// hostsPath returns the path of the hosts file consulted by r.
+func (r *Resolver) hostsPath() string {
+	if r.HostsPath != "" {
+		return r.HostsPath
+	}
+	return testHookHostsPath
+}
+
+// hostLookupOrder returns the order in which r looks up hostname.
+func (r *Resolver) hostLookupOrder(hostname string) hostLookupOrder {
+	order := systemConf().hostLookupOrder(hostname)
+	if order == hostLookupCgo && r.HostsPath != "" {
+		// The C library resolver cannot read r.HostsPath.
+		order = hostLookupFilesDNS
+	}
+	return order
+}
+
 // lookup entries from /etc/hosts
-func goLookupIPFiles(name string) (addrs []IPAddr) {
-	for _, haddr := range lookupStaticHost(name) {
+func (r *Resolver) goLookupIPFiles(name string) (addrs []IPAddr) {
+	for _, haddr := range lookupStaticHost(r.hostsPath(), name) {
 		haddr, zone := splitHostZone(haddr)
 		if ip := ParseIP(haddr); ip != nil {
 			addr := IPAddr{IP: ip, Zone: zone}
@@ -449,14 +507,14 @@ func goLookupIPFiles(name string) (addrs []IPAddr) {
 // goLookupIP is the native Go implementation of LookupIP.
 // The libc versions are in cgo_*.go.
 func (r *Resolver) goLookupIP(ctx context.Context, host string) (addrs []IPAddr, err error) {
-	order := systemConf().hostLookupOrder(host)
+	order := r.hostLookupOrder(host)
 	addrs, _, err = r.goLookupIPCNAMEOrder(ctx, host, order)
 	return
 }
 
 func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, name string, order hostLookupOrder) (addrs []IPAddr, cname string, err error) {
 	if order == hostLookupFilesDNS || order == hostLookupFiles {
-		addrs = goLookupIPFiles(name)
+		addrs = r.goLookupIPFiles(name)
 		if len(addrs) > 0 || order == hostLookupFiles {
 			return addrs, name, nil
 		}
@@ -501,6 +559,9 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, name string, order
 				continue
 			}
 			addrs = append(addrs, addrRecordList(racer.rrs)...)
+			if ttl, _ := ctx.Value(dnsAnswerTTLKey{}).(*dnsAnswerTTL); ttl != nil {
+				ttl.observe(racer.rrs)
+			}
 			if cname == "" {
 				cname = racer.cname
 			}
@@ -525,7 +586,7 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, name string, order
 	sortByRFC6724(addrs)
 	if len(addrs) == 0 {
 		if order == hostLookupDNSFiles {
-			addrs = goLookupIPFiles(name)
+			addrs = r.goLookupIPFiles(name)
 		}
 		if len(addrs) == 0 && lastErr != nil {
 			return nil, "", lastErr
@@ -536,7 +597,7 @@ func (r *Resolver) goLookupIPCNAMEOrder(ctx context.Context, name string, order
 
 // goLookupCNAME is the native Go (non-cgo) implementation of LookupCNAME.
 func (r *Resolver) goLookupCNAME(ctx context.Context, host string) (cname string, err error) {
-	order := systemConf().hostLookupOrder(host)
+	order := r.hostLookupOrder(host)
 	_, cname, err = r.goLookupIPCNAMEOrder(ctx, host, order)
 	return
 }
@@ -547,7 +608,7 @@ func (r *Resolver) goLookupCNAME(ctx context.Context, host string) (cname string
 // Normally we let cgo use the C library resolver instead of depending
 // on our lookup code, so that Go and C get the same answers.
 func (r *Resolver) goLookupPTR(ctx context.Context, addr string) ([]string, error) {
-	names := lookupStaticAddr(addr)
+	names := lookupStaticAddr(r.hostsPath(), addr)
 	if len(names) > 0 {
 		return names, nil
 	}
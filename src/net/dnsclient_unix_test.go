@@ -605,6 +605,170 @@ func TestGoLookupIPOrderFallbackToFile(t *testing.T) {
 	defer conf.teardown()
 }
 
+func TestResolverHostsPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-nettest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostsPath := path.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostsPath, []byte("192.0.2.77 custom.example # sandbox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Resolver{HostsPath: hostsPath}
+	ctx := context.Background()
+	addrs, err := r.LookupHost(ctx, "custom.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.77"}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("LookupHost = %v; want %v", addrs, want)
+	}
+	ips, err := r.LookupIPAddr(ctx, "custom.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].IP.Equal(ParseIP("192.0.2.77")) {
+		t.Errorf("LookupIPAddr = %v; want [192.0.2.77]", ips)
+	}
+	names, err := r.LookupAddr(ctx, "192.0.2.77")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"custom.example."}; !reflect.DeepEqual(names, want) {
+		t.Errorf("LookupAddr = %v; want %v", names, want)
+	}
+
+	// Other resolvers still read the global hosts file.
+	defer func(orig string) { testHookHostsPath = orig }(testHookHostsPath)
+	testHookHostsPath = "testdata/hosts"
+	if addrs := lookupStaticHost(goResolver.hostsPath(), "custom.example"); len(addrs) != 0 {
+		t.Errorf("default hosts file lookup = %v; want none", addrs)
+	}
+}
+
+func TestResolverHostsPathLookupGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-nettest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var rs []*Resolver
+	for i, addr := range []string{"192.0.2.1", "192.0.2.2"} {
+		hostsPath := path.Join(dir, fmt.Sprintf("hosts%d", i))
+		if err := ioutil.WriteFile(hostsPath, []byte(addr+" custom.example\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, &Resolver{HostsPath: hostsPath})
+	}
+
+	// Hold the lookups until both are in flight, so that they would
+	// be merged if they shared a group.
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	started := make(chan bool)
+	release := make(chan bool)
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		started <- true
+		<-release
+		return fn(ctx, host)
+	}
+
+	type result struct {
+		addrs []IPAddr
+		err   error
+	}
+	results := make([]chan result, len(rs))
+	for i, r := range rs {
+		results[i] = make(chan result, 1)
+		go func(r *Resolver, ch chan result) {
+			addrs, err := r.LookupIPAddr(context.Background(), "custom.example")
+			ch <- result{addrs, err}
+		}(r, results[i])
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lookup by resolver %d was merged with another one", i)
+		}
+	}
+	close(release)
+	for i, want := range []string{"192.0.2.1", "192.0.2.2"} {
+		res := <-results[i]
+		if res.err != nil {
+			t.Errorf("resolver %d: %v", i, res.err)
+			continue
+		}
+		if len(res.addrs) != 1 || !res.addrs[0].IP.Equal(ParseIP(want)) {
+			t.Errorf("resolver %d: LookupIPAddr = %v; want [%s]", i, res.addrs, want)
+		}
+	}
+}
+
+func TestResolverDelegate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-nettest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newResolver := func(name, hosts string) *Resolver {
+		hostsPath := path.Join(dir, name)
+		if err := ioutil.WriteFile(hostsPath, []byte(hosts), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return &Resolver{HostsPath: hostsPath}
+	}
+	internal := newResolver("internal", "10.0.0.1 db.corp.internal\n")
+	public := newResolver("public", "192.0.2.1 db.corp.internal\n192.0.2.80 www.example.com\n")
+	r := &Resolver{
+		Delegate: func(name string) *Resolver {
+			if strings.HasSuffix(name, ".internal") {
+				return internal
+			}
+			return public
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"db.corp.internal", "10.0.0.1"},
+		{"www.example.com", "192.0.2.80"},
+	} {
+		addrs, err := r.LookupHost(ctx, tt.name)
+		if err != nil {
+			t.Errorf("LookupHost(%q): %v", tt.name, err)
+		} else if len(addrs) != 1 || addrs[0] != tt.want {
+			t.Errorf("LookupHost(%q) = %v; want [%s]", tt.name, addrs, tt.want)
+		}
+		ips, err := r.LookupIPAddr(ctx, tt.name)
+		if err != nil {
+			t.Errorf("LookupIPAddr(%q): %v", tt.name, err)
+		} else if len(ips) != 1 || ips[0].String() != tt.want {
+			t.Errorf("LookupIPAddr(%q) = %v; want [%s]", tt.name, ips, tt.want)
+		}
+	}
+
+	// Dials resolve through the delegate, too.
+	var dialed string
+	d := Dialer{
+		Resolver: r,
+		DialTCP: func(ctx context.Context, network string, laddr, raddr *TCPAddr) (*TCPConn, error) {
+			dialed = raddr.String()
+			return nil, errConnRejected
+		},
+	}
+	if c, err := d.Dial("tcp", "db.corp.internal:5432"); err == nil {
+		c.Close()
+		t.Fatal("got connection; want error")
+	}
+	if want := "10.0.0.1:5432"; dialed != want {
+		t.Errorf("dialed %s; want %s", dialed, want)
+	}
+}
+
 // Issue 12712.
 // When using search domains, return the error encountered
 // querying the original name instead of an error encountered
@@ -1353,3 +1517,250 @@ func TestDNSGoroutineRace(t *testing.T) {
 		t.Fatal("fake DNS lookup unexpectedly succeeded")
 	}
 }
+
+func TestNegativeCache(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+	if err := conf.writeAndUpdate([]string{"nameserver 192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "nxdomain.example.com."
+	newServer := func(soa *dnsRR_SOA, queries *int) fakeDNSServer {
+		return fakeDNSServer{func(_, _ string, q *dnsMsg, _ time.Time) (*dnsMsg, error) {
+			*queries++
+			r := &dnsMsg{
+				dnsMsgHdr: dnsMsgHdr{
+					id:       q.id,
+					response: true,
+					rcode:    dnsRcodeNameError,
+				},
+				question: q.question,
+			}
+			if soa != nil {
+				r.ns = []dnsRR{soa}
+			}
+			return r, nil
+		}}
+	}
+	newSOA := func(ttl, minttl uint32) *dnsRR_SOA {
+		return &dnsRR_SOA{
+			Hdr: dnsRR_Header{
+				Name:   "example.com.",
+				Rrtype: dnsTypeSOA,
+				Class:  dnsClassINET,
+				Ttl:    ttl,
+			},
+			Ns:     "ns.example.com.",
+			Mbox:   "hostmaster.example.com.",
+			Minttl: minttl,
+		}
+	}
+
+	tests := []struct {
+		soa     *dnsRR_SOA
+		maxTTL  time.Duration
+		queries int           // queries made by two lookups
+		wantTTL time.Duration // expected negative caching TTL
+	}{
+		{newSOA(3600, 60), time.Hour, 1, 60 * time.Second},
+		{newSOA(30, 60), time.Hour, 1, 30 * time.Second},
+		{newSOA(3600, 60), 10 * time.Second, 1, 10 * time.Second},
+		{nil, time.Hour, 2, 0},
+		{newSOA(3600, 60), 0, 2, 0},
+	}
+	for i, tt := range tests {
+		var queries int
+		fake := newServer(tt.soa, &queries)
+		r := Resolver{PreferGo: true, Dial: fake.DialContext, MaxNegativeTTL: tt.maxTTL}
+		for j := 0; j < 2; j++ {
+			_, err := r.LookupTXT(context.Background(), name)
+			if err, ok := err.(*DNSError); !ok || err.Err != errNoSuchHost.Error() {
+				t.Errorf("#%d: lookup %d: got %v; want %v", i, j, err, errNoSuchHost)
+			}
+		}
+		if queries != tt.queries {
+			t.Errorf("#%d: got %d queries; want %d", i, queries, tt.queries)
+		}
+		exp, ok := r.getCaches().negative.expires[name]
+		if tt.wantTTL == 0 {
+			if ok {
+				t.Errorf("#%d: got negative cache entry expiring at %v; want none", i, exp)
+			}
+			continue
+		}
+		if ttl := exp.Sub(time.Now()); ttl > tt.wantTTL || ttl < tt.wantTTL-5*time.Second {
+			t.Errorf("#%d: got negative caching TTL of %v; want %v", i, ttl, tt.wantTTL)
+		}
+	}
+}
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	var c dnsNegativeCache
+	c.add("example.com.", time.Hour)
+	c.add("example.net.", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.lookup("example.com."); !ok {
+		t.Error("example.com. not in cache")
+	}
+	if _, ok := c.lookup("example.net."); ok {
+		t.Error("expired example.net. in cache")
+	}
+	if _, ok := c.expires["example.net."]; ok {
+		t.Error("expired example.net. not removed from cache")
+	}
+}
+
+func TestResolverCacheRecordTTL(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	fake := fakeDNSServer{func(_, _ string, q *dnsMsg, _ time.Time) (*dnsMsg, error) {
+		r := &dnsMsg{
+			dnsMsgHdr: dnsMsgHdr{
+				id:       q.id,
+				response: true,
+			},
+			question: q.question,
+		}
+		if q.question[0].Qtype == dnsTypeA {
+			r.answer = []dnsRR{
+				&dnsRR_A{
+					Hdr: dnsRR_Header{
+						Name:     q.question[0].Name,
+						Rrtype:   dnsTypeA,
+						Class:    dnsClassINET,
+						Ttl:      30,
+						Rdlength: 4,
+					},
+					A: TestAddr,
+				},
+			}
+		}
+		return r, nil
+	}}
+
+	const name = "www.example.com."
+	for _, tt := range []struct {
+		cacheTTL, wantTTL time.Duration
+	}{
+		{time.Hour, 30 * time.Second},
+		{10 * time.Second, 10 * time.Second},
+	} {
+		r := Resolver{PreferGo: true, Dial: fake.DialContext, CacheTTL: tt.cacheTTL}
+		if _, err := r.LookupIPAddr(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+		a, ok := r.getCaches().answers.entries[name]
+		if !ok {
+			t.Errorf("CacheTTL=%v: answer not cached", tt.cacheTTL)
+			continue
+		}
+		if ttl := a.expires.Sub(time.Now()); ttl > tt.wantTTL || ttl < tt.wantTTL-5*time.Second {
+			t.Errorf("CacheTTL=%v: got caching TTL of %v; want %v", tt.cacheTTL, ttl, tt.wantTTL)
+		}
+	}
+}
+
+func TestResolverCacheNegativeTTL(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+	if err := conf.writeAndUpdate([]string{"nameserver 192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var minttl uint32
+	queries := 0
+	fake := fakeDNSServer{func(_, _ string, q *dnsMsg, _ time.Time) (*dnsMsg, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries++
+		r := &dnsMsg{
+			dnsMsgHdr: dnsMsgHdr{
+				id:       q.id,
+				response: true,
+				rcode:    dnsRcodeNameError,
+			},
+			question: q.question,
+		}
+		if minttl > 0 {
+			r.ns = []dnsRR{&dnsRR_SOA{
+				Hdr: dnsRR_Header{
+					Name:   "example.com.",
+					Rrtype: dnsTypeSOA,
+					Class:  dnsClassINET,
+					Ttl:    3600,
+				},
+				Ns:     "ns.example.com.",
+				Mbox:   "hostmaster.example.com.",
+				Minttl: minttl,
+			}}
+		}
+		return r, nil
+	}}
+
+	const name = "nxdomain.example.com."
+	for _, tt := range []struct {
+		minttl  uint32        // 0 for no SOA record
+		wantTTL time.Duration // 0 for not cached
+	}{
+		{1, time.Second},
+		{7200, time.Hour},
+		{0, 0},
+	} {
+		mu.Lock()
+		minttl = tt.minttl
+		mu.Unlock()
+		r := Resolver{PreferGo: true, Dial: fake.DialContext, CacheTTL: time.Hour}
+		if _, err := r.LookupIPAddr(context.Background(), name); !isNoSuchHost(err) {
+			t.Fatalf("got %v; want %v", err, errNoSuchHost)
+		}
+		a, ok := r.getCaches().answers.entries[name]
+		if tt.wantTTL == 0 {
+			if ok {
+				t.Errorf("MINIMUM=%d: got answer cached until %v; want none", tt.minttl, a.expires)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("MINIMUM=%d: answer not cached", tt.minttl)
+			continue
+		}
+		if ttl := time.Until(a.expires); ttl > tt.wantTTL || ttl < tt.wantTTL-5*time.Second {
+			t.Errorf("MINIMUM=%d: got caching TTL of %v; want %v", tt.minttl, ttl, tt.wantTTL)
+		}
+	}
+
+	// An answer cached for the short negative TTL expires before
+	// CacheTTL, and the name is queried again.
+	mu.Lock()
+	minttl, queries = 1, 0
+	mu.Unlock()
+	r := Resolver{PreferGo: true, Dial: fake.DialContext, CacheTTL: time.Hour}
+	for i := 0; i < 2; i++ {
+		r.LookupIPAddr(context.Background(), name)
+	}
+	mu.Lock()
+	if queries != 2 {
+		t.Errorf("got %d queries for two lookups within the negative TTL; want 2", queries)
+	}
+	queries = 0
+	mu.Unlock()
+	time.Sleep(1100 * time.Millisecond)
+	r.LookupIPAddr(context.Background(), name)
+	mu.Lock()
+	defer mu.Unlock()
+	if queries != 2 {
+		t.Errorf("got %d queries after the negative TTL; want 2", queries)
+	}
+}
@@ -100,7 +100,7 @@ second:
 	}
 	switch nestedErr {
 	case errCanceled, poll.ErrNetClosing, errMissingAddress, errNoSuitableAddress,
-		context.DeadlineExceeded, context.Canceled:
+		errConnRejected, ErrTLSReserve, context.DeadlineExceeded, context.Canceled:
 		return nil
 	}
 	return fmt.Errorf("unexpected type on 2nd nested level: %T", nestedErr)
@@ -0,0 +1,20 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"syscall"
+)
+
+const _WSAECONNREFUSED = syscall.Errno(10061)
+
+// isConnRefused reports whether err reports a refused connection.
+func isConnRefused(err error) bool {
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == _WSAECONNREFUSED || err == syscall.ECONNREFUSED
+}
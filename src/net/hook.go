@@ -19,4 +19,5 @@ var (
 		return fn(ctx, host)
 	}
 	testHookSetKeepAlive = func() {}
+	testHookSrcAddrs     = srcAddrs
 )
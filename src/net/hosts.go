@@ -27,10 +27,15 @@ func parseLiteralIP(addr string) string {
 	return ip.String() + "%" + zone
 }
 
-// hosts contains known host entries.
+// hosts contains the known host entries of the hosts files read,
+// by path.
 var hosts struct {
 	sync.Mutex
+	byPath map[string]*hostsCache
+}
 
+// hostsCache contains the host entries of a hosts file.
+type hostsCache struct {
 	// Key for the list of literal IP addresses must be a host
 	// name. It would be part of DNS labels, a FQDN or an absolute
 	// FQDN.
@@ -43,29 +48,31 @@ var hosts struct {
 	byAddr map[string][]string
 
 	expire time.Time
-	path   string
 	mtime  time.Time
 	size   int64
 }
 
-func readHosts() {
+// readHosts updates the host entries of the hosts file at hp, if
+// needed, and returns them, or nil if the file was never read.
+// hosts must be locked.
+func readHosts(hp string) *hostsCache {
 	now := time.Now()
-	hp := testHookHostsPath
 
-	if now.Before(hosts.expire) && hosts.path == hp && len(hosts.byName) > 0 {
-		return
+	c := hosts.byPath[hp]
+	if c != nil && now.Before(c.expire) && len(c.byName) > 0 {
+		return c
 	}
 	mtime, size, err := stat(hp)
-	if err == nil && hosts.path == hp && hosts.mtime.Equal(mtime) && hosts.size == size {
-		hosts.expire = now.Add(cacheMaxAge)
-		return
+	if err == nil && c != nil && c.mtime.Equal(mtime) && c.size == size {
+		c.expire = now.Add(cacheMaxAge)
+		return c
 	}
 
 	hs := make(map[string][]string)
 	is := make(map[string][]string)
 	var file *file
 	if file, _ = open(hp); file == nil {
-		return
+		return c
 	}
 	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
 		if i := byteIndex(line, '#'); i >= 0 {
@@ -90,26 +97,33 @@ func readHosts() {
 		}
 	}
 	// Update the data cache.
-	hosts.expire = now.Add(cacheMaxAge)
-	hosts.path = hp
-	hosts.byName = hs
-	hosts.byAddr = is
-	hosts.mtime = mtime
-	hosts.size = size
+	c = &hostsCache{
+		expire: now.Add(cacheMaxAge),
+		byName: hs,
+		byAddr: is,
+		mtime:  mtime,
+		size:   size,
+	}
+	if hosts.byPath == nil {
+		hosts.byPath = make(map[string]*hostsCache)
+	}
+	hosts.byPath[hp] = c
 	file.close()
+	return c
 }
 
-// lookupStaticHost looks up the addresses for the given host from /etc/hosts.
-func lookupStaticHost(host string) []string {
+// lookupStaticHost looks up the addresses for the given host from the
+// hosts file at hostsPath.
+func lookupStaticHost(hostsPath, host string) []string {
 	hosts.Lock()
 	defer hosts.Unlock()
-	readHosts()
-	if len(hosts.byName) != 0 {
+	c := readHosts(hostsPath)
+	if c != nil && len(c.byName) != 0 {
 		// TODO(jbd,bradfitz): avoid this alloc if host is already all lowercase?
 		// or linear scan the byName map if it's small enough?
 		lowerHost := []byte(host)
 		lowerASCIIBytes(lowerHost)
-		if ips, ok := hosts.byName[absDomainName(lowerHost)]; ok {
+		if ips, ok := c.byName[absDomainName(lowerHost)]; ok {
 			ipsCp := make([]string, len(ips))
 			copy(ipsCp, ips)
 			return ipsCp
@@ -118,17 +132,18 @@ func lookupStaticHost(host string) []string {
 	return nil
 }
 
-// lookupStaticAddr looks up the hosts for the given address from /etc/hosts.
-func lookupStaticAddr(addr string) []string {
+// lookupStaticAddr looks up the hosts for the given address from the
+// hosts file at hostsPath.
+func lookupStaticAddr(hostsPath, addr string) []string {
 	hosts.Lock()
 	defer hosts.Unlock()
-	readHosts()
+	c := readHosts(hostsPath)
 	addr = parseLiteralIP(addr)
 	if addr == "" {
 		return nil
 	}
-	if len(hosts.byAddr) != 0 {
-		if hosts, ok := hosts.byAddr[addr]; ok {
+	if c != nil && len(c.byAddr) != 0 {
+		if hosts, ok := c.byAddr[addr]; ok {
 			hostsCp := make([]string, len(hosts))
 			copy(hostsCp, hosts)
 			return hostsCp
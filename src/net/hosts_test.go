@@ -72,7 +72,7 @@ func TestLookupStaticHost(t *testing.T) {
 func testStaticHost(t *testing.T, hostsPath string, ent staticHostEntry) {
 	ins := []string{ent.in, absDomainName([]byte(ent.in)), strings.ToLower(ent.in), strings.ToUpper(ent.in)}
 	for _, in := range ins {
-		addrs := lookupStaticHost(in)
+		addrs := lookupStaticHost(hostsPath, in)
 		if !reflect.DeepEqual(addrs, ent.out) {
 			t.Errorf("%s, lookupStaticHost(%s) = %v; want %v", hostsPath, in, addrs, ent.out)
 		}
@@ -139,7 +139,7 @@ func TestLookupStaticAddr(t *testing.T) {
 }
 
 func testStaticAddr(t *testing.T, hostsPath string, ent staticHostEntry) {
-	hosts := lookupStaticAddr(ent.in)
+	hosts := lookupStaticAddr(hostsPath, ent.in)
 	for i := range ent.out {
 		ent.out[i] = absDomainName([]byte(ent.out[i]))
 	}
@@ -157,7 +157,7 @@ func TestHostCacheModification(t *testing.T) {
 	ent := staticHostEntry{"localhost", []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}}
 	testStaticHost(t, testHookHostsPath, ent)
 	// Modify the addresses return by lookupStaticHost.
-	addrs := lookupStaticHost(ent.in)
+	addrs := lookupStaticHost(testHookHostsPath, ent.in)
 	for i := range addrs {
 		addrs[i] += "junk"
 	}
@@ -167,9 +167,33 @@ func TestHostCacheModification(t *testing.T) {
 	ent = staticHostEntry{"::1", []string{"localhost"}}
 	testStaticAddr(t, testHookHostsPath, ent)
 	// Modify the hosts return by lookupStaticAddr.
-	hosts := lookupStaticAddr(ent.in)
+	hosts := lookupStaticAddr(testHookHostsPath, ent.in)
 	for i := range hosts {
 		hosts[i] += "junk"
 	}
 	testStaticAddr(t, testHookHostsPath, ent)
 }
+
+func TestHostCachePaths(t *testing.T) {
+	// Lookups alternating between hosts files must not evict each
+	// other's entries from the cache.
+	paths := []string{"testdata/ipv4-hosts", "testdata/ipv6-hosts"}
+	caches := make(map[string]*hostsCache)
+	for i := 0; i < 4; i++ {
+		for _, path := range paths {
+			lookupStaticHost(path, "localhost")
+			hosts.Lock()
+			c := hosts.byPath[path]
+			hosts.Unlock()
+			if c == nil {
+				t.Fatalf("%s: not cached", path)
+			}
+			if prev := caches[path]; prev != nil && prev != c {
+				t.Errorf("%s: read again after a lookup in another file", path)
+			}
+			caches[path] = c
+		}
+	}
+	testStaticHost(t, paths[0], staticHostEntry{"localhost", []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}})
+	testStaticHost(t, paths[1], staticHostEntry{"localhost", []string{"::1", "fe80::1", "fe80::2%lo0", "fe80::3%lo0"}})
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// A ConnRecorder serves a handler on one end of an in-memory
+// connection, and sends it requests on the other end with RoundTrip.
+// It records both the bytes of the responses as sent on the wire and
+// the response to the last request, as written by the handler, in a
+// ResponseRecorder.
+//
+// A ConnRecorder is useful to test the behavior of a handler that
+// depends on a real connection, such as streaming with Flush.
+type ConnRecorder struct {
+	// ServerConn and ClientConn are the ends of the connection on
+	// which the handler is served and requests are sent. Before the
+	// first call of RoundTrip, they may be replaced, for instance by
+	// wrappers injecting faults. After it, they may be closed, or
+	// their deadlines set, to simulate network failures.
+	ServerConn, ClientConn net.Conn
+
+	// Recorder records the response of the handler to the last
+	// request sent by RoundTrip. Its Code, HeaderMap, Body, and
+	// FlushPoints are set as the handler runs, and should only be
+	// inspected once the body of the response has been read.
+	Recorder *ResponseRecorder
+
+	// Wire contains the bytes read from ClientConn.
+	Wire bytes.Buffer
+
+	handler http.Handler
+	once    sync.Once
+	srv     *http.Server
+	br      *bufio.Reader
+}
+
+// NewConnRecorder returns a ConnRecorder serving handler on a
+// connection made by net.Pipe.
+func NewConnRecorder(handler http.Handler) *ConnRecorder {
+	c1, c2 := net.Pipe()
+	return &ConnRecorder{
+		ServerConn: c1,
+		ClientConn: c2,
+		handler:    handler,
+	}
+}
+
+// RoundTrip implements http.RoundTripper. It sends req on c.ClientConn,
+// with a new c.Recorder to record the handler's response, and reads the
+// response. Like http.Transport.RoundTrip, it returns once the header of
+// the response has been read; the body is read from the connection as
+// the caller reads it.
+//
+// RoundTrip must not be called until the body of the previous response
+// has been read and closed.
+func (c *ConnRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.once.Do(c.start)
+	c.Recorder = NewRecorder()
+
+	// Write the request concurrently, as the handler may respond
+	// before reading all of its body.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- req.Write(c.ClientConn)
+	}()
+	res, err := http.ReadResponse(c.br, req)
+	if err != nil {
+		select {
+		case werr := <-errc:
+			if werr != nil {
+				return nil, werr
+			}
+		default:
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// Close closes the connection and stops serving the handler.
+func (c *ConnRecorder) Close() error {
+	c.once.Do(c.start)
+	c.ClientConn.Close()
+	return c.srv.Close()
+}
+
+func (c *ConnRecorder) start() {
+	c.br = bufio.NewReader(io.TeeReader(c.ClientConn, &c.Wire))
+	c.srv = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.handler.ServeHTTP(c.writer(w), r)
+		}),
+	}
+	go c.srv.Serve(&connListener{c: c.ServerConn, done: make(chan struct{})})
+}
+
+// writer returns a ResponseWriter sending the response written to it
+// to w, and recording it in c.Recorder.
+func (c *ConnRecorder) writer(w http.ResponseWriter) http.ResponseWriter {
+	rec := c.Recorder
+	// Share the header, so that the recorder snapshots it when
+	// it is sent.
+	rec.HeaderMap = w.Header()
+	return &teeResponseWriter{w: w, rec: rec}
+}
+
+// A teeResponseWriter is a ResponseWriter writing the response both
+// to w and to rec.
+type teeResponseWriter struct {
+	w   http.ResponseWriter
+	rec *ResponseRecorder
+}
+
+func (tw *teeResponseWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+func (tw *teeResponseWriter) WriteHeader(code int) {
+	tw.w.WriteHeader(code)
+	tw.rec.WriteHeader(code)
+}
+
+func (tw *teeResponseWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	tw.rec.Write(p[:n])
+	return n, err
+}
+
+func (tw *teeResponseWriter) Flush() {
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	tw.rec.Flush()
+}
+
+// A connListener is a net.Listener accepting c once.
+type connListener struct {
+	mu   sync.Mutex
+	c    net.Conn
+	done chan struct{}
+}
+
+var errListenerClosed = errors.New("httptest: listener closed")
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	c := l.c
+	l.c = nil
+	l.mu.Unlock()
+	if c != nil {
+		return c, nil
+	}
+	<-l.done
+	return nil, errListenerClosed
+}
+
+func (l *connListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
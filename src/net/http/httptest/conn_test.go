@@ -0,0 +1,114 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnRecorderStreaming(t *testing.T) {
+	chunks := []string{"a", "bb", "ccc"}
+	next := make(chan bool)
+	cr := NewConnRecorder(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for _, chunk := range chunks {
+			io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	}))
+	defer cr.Close()
+
+	res, err := cr.RoundTrip(NewRequest("GET", "http://example.com/", nil))
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("StatusCode = %d; want 200", res.StatusCode)
+	}
+	if got := res.TransferEncoding; !reflect.DeepEqual(got, []string{"chunked"}) {
+		t.Errorf("TransferEncoding = %q; want chunked", got)
+	}
+	// Each chunk is readable as soon as it is flushed, before the
+	// handler writes the next one.
+	for _, chunk := range chunks {
+		buf := make([]byte, len(chunk))
+		if _, err := io.ReadFull(res.Body, buf); err != nil {
+			t.Fatalf("reading chunk %q: %v", chunk, err)
+		}
+		if string(buf) != chunk {
+			t.Errorf("read chunk %q; want %q", buf, chunk)
+		}
+		next <- true
+	}
+	if rest, err := ioutil.ReadAll(res.Body); err != nil || len(rest) != 0 {
+		t.Errorf("reading end of body = %q, %v; want no more data", rest, err)
+	}
+
+	rec := cr.Recorder
+	if rec.Code != 200 {
+		t.Errorf("Recorder.Code = %d; want 200", rec.Code)
+	}
+	if got, want := rec.Body.String(), "abbccc"; got != want {
+		t.Errorf("Recorder.Body = %q; want %q", got, want)
+	}
+	if got, want := rec.FlushPoints, []int{1, 3, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Recorder.FlushPoints = %v; want %v", got, want)
+	}
+	if got := rec.Result().Header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Recorder Content-Type = %q; want text/plain", got)
+	}
+
+	wire := cr.Wire.String()
+	if !strings.HasPrefix(wire, "HTTP/1.1 200 OK\r\n") {
+		t.Errorf("response on the wire does not start with the status line:\n%s", wire)
+	}
+	for _, want := range []string{
+		"Transfer-Encoding: chunked\r\n",
+		"\r\n\r\n1\r\na\r\n2\r\nbb\r\n3\r\nccc\r\n0\r\n\r\n",
+	} {
+		if !strings.Contains(wire, want) {
+			t.Errorf("response on the wire does not contain %q:\n%s", want, wire)
+		}
+	}
+}
+
+func TestConnRecorderLargeBody(t *testing.T) {
+	body := strings.Repeat("x", 1<<20)
+	cr := NewConnRecorder(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(ioutil.Discard, r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		io.WriteString(w, strings.Repeat("y", int(n)))
+	}))
+	defer cr.Close()
+
+	req, err := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := cr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	got, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("reading response body: %v", err)
+	}
+	if len(got) != len(body) {
+		t.Errorf("read %d bytes of body; want %d", len(got), len(body))
+	}
+	if n := cr.Recorder.Body.Len(); n != len(body) {
+		t.Errorf("Recorder.Body has %d bytes; want %d", n, len(body))
+	}
+}
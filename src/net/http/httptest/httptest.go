@@ -11,7 +11,9 @@ import (
 	"crypto/tls"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -89,3 +91,107 @@ func NewRequest(method, target string, body io.Reader) *http.Request {
 
 	return req
 }
+
+// NewMultipartRequest returns a new incoming server Request, like
+// NewRequest, whose body is a multipart/form-data form holding the
+// given fields and files. The Content-Type header, including the
+// multipart boundary, is set.
+//
+// Each file is sent as a form file under the field name of its map key,
+// which is also used as its file name. Fields and files are written in
+// sorted order of their names.
+//
+// NewMultipartRequest returns an error if reading a file fails. Like
+// NewRequest, it panics if method or target is invalid.
+func NewMultipartRequest(method, target string, fields map[string]string, files map[string]io.Reader) (*http.Request, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return nil, err
+		}
+	}
+	names = names[:0]
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fw, err := mw.CreateFormFile(name, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(fw, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	req := NewRequest(method, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req, nil
+}
+
+// TB is the subset of testing.TB used by the checking helpers in
+// this package. It is implemented by *testing.T and *testing.B.
+type TB interface {
+	Errorf(format string, args ...interface{})
+}
+
+// helper marks the calling function as a test helper function,
+// if t supports it.
+func helper(t TB) {
+	if h, ok := t.(interface {
+		Helper()
+	}); ok {
+		h.Helper()
+	}
+}
+
+// CheckBodyConsumed serves r with h using a new ResponseRecorder,
+// which it returns. It reports an error to t if the handler neither
+// read the request body to EOF nor closed it.
+//
+// A handler that leaves the body unconsumed prevents the server
+// from reusing the connection.
+func CheckBodyConsumed(t TB, h http.Handler, r *http.Request) *ResponseRecorder {
+	helper(t)
+	var body *consumeTracker
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &consumeTracker{ReadCloser: r.Body}
+		r.Body = body
+	}
+	rw := NewRecorder()
+	h.ServeHTTP(rw, r)
+	if body != nil && !body.eof && !body.closed {
+		t.Errorf("handler for %s %s did not read the request body to EOF or close it", r.Method, r.URL)
+	}
+	return rw
+}
+
+// consumeTracker is a request body that records whether it was read
+// to EOF or closed.
+type consumeTracker struct {
+	io.ReadCloser
+	eof    bool
+	closed bool
+}
+
+func (b *consumeTracker) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *consumeTracker) Close() error {
+	b.closed = true
+	return b.ReadCloser.Close()
+}
@@ -6,6 +6,7 @@ package httptest
 
 import (
 	"crypto/tls"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -175,3 +176,105 @@ func TestNewRequest(t *testing.T) {
 		}
 	}
 }
+
+// errorRecorder is a TB that records reported errors.
+type errorRecorder struct {
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCheckBodyConsumed(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		handler func(w http.ResponseWriter, r *http.Request)
+		wantErr bool
+	}{
+		{
+			name:    "ignored",
+			body:    strings.NewReader("foo"),
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			wantErr: true,
+		},
+		{
+			name: "partially read",
+			body: strings.NewReader("foo"),
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Body.Read(make([]byte, 1))
+			},
+			wantErr: true,
+		},
+		{
+			name: "drained",
+			body: strings.NewReader("foo"),
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+			},
+		},
+		{
+			name: "closed",
+			body: strings.NewReader("foo"),
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Body.Close()
+			},
+		},
+		{
+			name:    "no body",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+		},
+	}
+	for _, tt := range tests {
+		var rec errorRecorder
+		req := NewRequest("POST", "/", tt.body)
+		rw := CheckBodyConsumed(&rec, http.HandlerFunc(tt.handler), req)
+		if gotErr := len(rec.errors) > 0; gotErr != tt.wantErr {
+			t.Errorf("%s: got errors %q; want error: %v", tt.name, rec.errors, tt.wantErr)
+		}
+		if rw == nil {
+			t.Errorf("%s: got nil ResponseRecorder", tt.name)
+		}
+	}
+}
+
+func TestNewMultipartRequest(t *testing.T) {
+	req, err := NewMultipartRequest("POST", "/upload",
+		map[string]string{"name": "gopher", "color": "blue"},
+		map[string]io.Reader{"avatar": strings.NewReader("image data")},
+	)
+	if err != nil {
+		t.Fatalf("NewMultipartRequest: %v", err)
+	}
+	if req.ContentLength <= 0 {
+		t.Errorf("ContentLength = %d; want > 0", req.ContentLength)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		for name, want := range map[string]string{"name": "gopher", "color": "blue"} {
+			if got := r.FormValue(name); got != want {
+				t.Errorf("FormValue(%q) = %q; want %q", name, got, want)
+			}
+		}
+		f, fh, err := r.FormFile("avatar")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		defer f.Close()
+		if fh.Filename != "avatar" {
+			t.Errorf("file name = %q; want %q", fh.Filename, "avatar")
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("reading form file: %v", err)
+		}
+		if string(data) != "image data" {
+			t.Errorf("file contents = %q; want %q", data, "image data")
+		}
+	})
+	h.ServeHTTP(NewRecorder(), req)
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnmarshalBody decodes the recorded response body as JSON into v.
+func (rw *ResponseRecorder) UnmarshalBody(v interface{}) error {
+	if rw.Body == nil {
+		return fmt.Errorf("httptest: no response body recorded")
+	}
+	return json.Unmarshal(rw.Body.Bytes(), v)
+}
+
+// maxJSONDiffs is the maximum number of differences reported
+// by AssertJSONEqual.
+const maxJSONDiffs = 10
+
+// AssertJSONEqual reports an error to t if the body recorded by rec
+// is not structurally equal to the JSON document wantJSON.
+// Object keys are compared regardless of order, and whitespace
+// is ignored. The report lists the paths at which the documents
+// differ.
+func AssertJSONEqual(t TB, rec *ResponseRecorder, wantJSON string) {
+	helper(t)
+	var want interface{}
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Errorf("invalid wanted JSON: %v", err)
+		return
+	}
+	var got interface{}
+	if err := rec.UnmarshalBody(&got); err != nil {
+		t.Errorf("response body is not valid JSON: %v\nbody: %q", err, rec.Body)
+		return
+	}
+	diffs := jsonDiff(nil, "$", got, want)
+	if len(diffs) == 0 {
+		return
+	}
+	if len(diffs) > maxJSONDiffs {
+		diffs = append(diffs[:maxJSONDiffs], fmt.Sprintf("... and %d more", len(diffs)-maxJSONDiffs))
+	}
+	t.Errorf("response body does not match wanted JSON:\n\t%s", strings.Join(diffs, "\n\t"))
+}
+
+// jsonDiff appends to diffs a description of each difference
+// between the decoded JSON values got and want, found at path.
+func jsonDiff(diffs []string, path string, got, want interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "." + k
+			gv, gok := g[k]
+			wv, wok := w[k]
+			switch {
+			case !gok:
+				diffs = append(diffs, fmt.Sprintf("%s: missing, want %s", p, jsonString(wv)))
+			case !wok:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", p, jsonString(gv)))
+			default:
+				diffs = jsonDiff(diffs, p, gv, wv)
+			}
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		if len(g) != len(w) {
+			return append(diffs, fmt.Sprintf("%s: got array of length %d, want %d", path, len(g), len(w)))
+		}
+		for i := range w {
+			diffs = jsonDiff(diffs, fmt.Sprintf("%s[%d]", path, i), g[i], w[i])
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(got, want) {
+		diffs = append(diffs, fmt.Sprintf("%s: got %s, want %s", path, jsonString(got), jsonString(want)))
+	}
+	return diffs
+}
+
+// jsonString returns the JSON encoding of v, for use in messages.
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func jsonHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+}
+
+func TestUnmarshalBody(t *testing.T) {
+	rec := NewRecorder()
+	jsonHandler(`{"name": "gopher", "tags": ["a", "b"]}`).ServeHTTP(rec, NewRequest("GET", "/", nil))
+	var v struct {
+		Name string
+		Tags []string
+	}
+	if err := rec.UnmarshalBody(&v); err != nil {
+		t.Fatalf("UnmarshalBody: %v", err)
+	}
+	if v.Name != "gopher" || len(v.Tags) != 2 || v.Tags[0] != "a" || v.Tags[1] != "b" {
+		t.Errorf("UnmarshalBody = %+v", v)
+	}
+
+	rec = NewRecorder()
+	jsonHandler(`not json`).ServeHTTP(rec, NewRequest("GET", "/", nil))
+	if err := rec.UnmarshalBody(&v); err == nil {
+		t.Error("UnmarshalBody of invalid JSON succeeded")
+	}
+}
+
+func TestAssertJSONEqual(t *testing.T) {
+	tests := []struct {
+		body, want string
+		diffs      []string // substrings of the reported error; nil means no error
+	}{
+		{
+			body: `{"a": 1, "b": {"c": [1, 2], "d": null}}`,
+			want: `{"b":{"d":null,"c":[1,2]},"a":1.0}`,
+		},
+		{
+			body: `{"a": 1, "b": {"c": [1, 3]}, "e": true}`,
+			want: `{"a": 2, "b": {"c": [1, 2], "d": "x"}}`,
+			diffs: []string{
+				"$.a: got 1, want 2",
+				"$.b.c[1]: got 3, want 2",
+				`$.b.d: missing, want "x"`,
+				"$.e: unexpected true",
+			},
+		},
+		{
+			body:  `[1, 2, 3]`,
+			want:  `[1, 2]`,
+			diffs: []string{"$: got array of length 3, want 2"},
+		},
+		{
+			body:  `{"a": [1]}`,
+			want:  `{"a": {"b": 1}}`,
+			diffs: []string{`$.a: got [1], want {"b":1}`},
+		},
+		{
+			body:  `{"a": `,
+			want:  `{}`,
+			diffs: []string{"response body is not valid JSON"},
+		},
+		{
+			body:  `{}`,
+			want:  `{`,
+			diffs: []string{"invalid wanted JSON"},
+		},
+	}
+	for i, tt := range tests {
+		rec := NewRecorder()
+		jsonHandler(tt.body).ServeHTTP(rec, NewRequest("GET", "/", nil))
+		var er errorRecorder
+		AssertJSONEqual(&er, rec, tt.want)
+		if tt.diffs == nil {
+			if len(er.errors) != 0 {
+				t.Errorf("%d. unexpected errors: %q", i, er.errors)
+			}
+			continue
+		}
+		if len(er.errors) != 1 {
+			t.Errorf("%d. got %d errors, want 1: %q", i, len(er.errors), er.errors)
+			continue
+		}
+		for _, d := range tt.diffs {
+			if !strings.Contains(er.errors[0], d) {
+				t.Errorf("%d. error %q does not contain %q", i, er.errors[0], d)
+			}
+		}
+	}
+}
@@ -5,12 +5,16 @@
 package httptest
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // ResponseRecorder is an implementation of http.ResponseWriter that
@@ -34,12 +38,63 @@ type ResponseRecorder struct {
 	// If nil, the Writes are silently discarded.
 	Body *bytes.Buffer
 
+	// MaxBodyBytes, if positive, limits the number of bytes recorded
+	// in Body. Writes beyond the limit still succeed, but their data
+	// is discarded and BodyTruncated is set.
+	MaxBodyBytes int
+
+	// BodyTruncated is whether data was discarded because of
+	// MaxBodyBytes.
+	BodyTruncated bool
+
 	// Flushed is whether the Handler called Flush.
 	Flushed bool
 
+	// FlushPoints contains, for each call of Flush by the Handler,
+	// the number of body bytes written before it.
+	FlushPoints []int
+
+	// HijackConn, if non-nil, is the connection returned by Hijack.
+	// If nil, Hijack returns http.ErrNotSupported.
+	HijackConn net.Conn
+
+	// Hijacked is whether the Handler hijacked the connection.
+	// Once it has, writes to rw are no longer recorded.
+	Hijacked bool
+
+	// WriteHook, if non-nil, is called by Write and WriteString with
+	// the data being written, to simulate write failures. If it
+	// returns a non-nil error, only the first n bytes of p are
+	// recorded, and the write reports n and the error.
+	WriteHook func(p []byte) (n int, err error)
+
+	// Informational contains the informational (1xx) responses
+	// written by the Handler before its final response, in order.
+	Informational []InformationalResponse
+
+	// WriteHeaderCalls contains the codes passed to each call of
+	// WriteHeader by the Handler, in order, including the calls
+	// that had no effect because the header was already written.
+	// The implicit WriteHeader of the first Write or Flush is not
+	// recorded.
+	WriteHeaderCalls []int
+
 	result      *http.Response // cache of Result's return value
 	snapHeader  http.Header    // snapshot of HeaderMap at first Write
 	wroteHeader bool
+	written     int // number of body bytes written, including discarded ones
+
+	mu           sync.Mutex // guards following, set by Disconnect
+	disconnected bool
+	closeNotify  chan bool            // returned by CloseNotify
+	cancels      []context.CancelFunc // of requests from WithDisconnect
+}
+
+// InformationalResponse is an informational (1xx) response
+// recorded by a ResponseRecorder.
+type InformationalResponse struct {
+	Code   int
+	Header http.Header // snapshot of the headers when it was written
 }
 
 // NewRecorder returns an initialized ResponseRecorder.
@@ -91,31 +146,100 @@ func (rw *ResponseRecorder) writeHeader(b []byte, str string) {
 		m.Set("Content-Type", http.DetectContentType(b))
 	}
 
-	rw.WriteHeader(200)
+	rw.writeStatus(200)
 }
 
-// Write always succeeds and writes to rw.Body, if not nil.
+// writeFailure reports the result of rw.WriteHook for p, if any:
+// the number of bytes written and the error of a failed write.
+func (rw *ResponseRecorder) writeFailure(p []byte) (int, error) {
+	if rw.WriteHook == nil {
+		return len(p), nil
+	}
+	n, err := rw.WriteHook(p)
+	if err == nil {
+		return len(p), nil
+	}
+	if n < 0 {
+		n = 0
+	} else if n > len(p) {
+		n = len(p)
+	}
+	return n, err
+}
+
+// Write writes to rw.Body, if not nil. It succeeds unless the
+// connection has been hijacked or rw.WriteHook fails.
 func (rw *ResponseRecorder) Write(buf []byte) (int, error) {
+	if rw.Hijacked {
+		return 0, http.ErrHijacked
+	}
 	rw.writeHeader(buf, "")
+	n, err := rw.writeFailure(buf)
+	rw.written += n
 	if rw.Body != nil {
-		rw.Body.Write(buf)
+		rw.Body.Write(buf[:rw.bodyRoom(n)])
 	}
-	return len(buf), nil
+	return n, err
 }
 
-// WriteString always succeeds and writes to rw.Body, if not nil.
+// WriteString writes to rw.Body, if not nil. It succeeds unless the
+// connection has been hijacked or rw.WriteHook fails.
 func (rw *ResponseRecorder) WriteString(str string) (int, error) {
+	if rw.Hijacked {
+		return 0, http.ErrHijacked
+	}
 	rw.writeHeader(nil, str)
+	n, err := len(str), error(nil)
+	if rw.WriteHook != nil {
+		n, err = rw.writeFailure([]byte(str))
+	}
+	rw.written += n
 	if rw.Body != nil {
-		rw.Body.WriteString(str)
+		rw.Body.WriteString(str[:rw.bodyRoom(n)])
 	}
-	return len(str), nil
+	return n, err
+}
+
+// bodyRoom returns how many of n more bytes can be recorded in rw.Body
+// within rw.MaxBodyBytes, setting rw.BodyTruncated if not all of them.
+func (rw *ResponseRecorder) bodyRoom(n int) int {
+	if rw.MaxBodyBytes <= 0 {
+		return n
+	}
+	room := rw.MaxBodyBytes - rw.Body.Len()
+	if room < 0 {
+		room = 0
+	}
+	if n > room {
+		rw.BodyTruncated = true
+		return room
+	}
+	return n
 }
 
 // WriteHeader sets rw.Code. After it is called, changing rw.Header
 // will not affect rw.HeaderMap.
+//
+// Informational (1xx) codes other than 101 Switching Protocols are
+// instead appended to rw.Informational, and the final code may still
+// be written afterwards.
+//
+// Each call is recorded in rw.WriteHeaderCalls.
 func (rw *ResponseRecorder) WriteHeader(code int) {
-	if rw.wroteHeader {
+	rw.WriteHeaderCalls = append(rw.WriteHeaderCalls, code)
+	rw.writeStatus(code)
+}
+
+// writeStatus implements WriteHeader, without recording the call.
+func (rw *ResponseRecorder) writeStatus(code int) {
+	if rw.wroteHeader || rw.Hijacked {
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		rw.Informational = append(rw.Informational, InformationalResponse{
+			Code:   code,
+			Header: cloneHeader(rw.Header()),
+		})
 		return
 	}
 	rw.Code = code
@@ -136,12 +260,80 @@ func cloneHeader(h http.Header) http.Header {
 	return h2
 }
 
-// Flush sets rw.Flushed to true.
+// Flush sets rw.Flushed to true and records the flush in rw.FlushPoints.
 func (rw *ResponseRecorder) Flush() {
+	if rw.Hijacked {
+		return
+	}
 	if !rw.wroteHeader {
-		rw.WriteHeader(200)
+		rw.writeStatus(200)
 	}
 	rw.Flushed = true
+	rw.FlushPoints = append(rw.FlushPoints, rw.written)
+}
+
+// Hijack implements http.Hijacker. It returns rw.HijackConn and a
+// bufio.ReadWriter on it, and sets rw.Hijacked to true.
+// If rw.HijackConn is nil, it returns http.ErrNotSupported.
+func (rw *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if rw.HijackConn == nil {
+		return nil, nil, http.ErrNotSupported
+	}
+	if rw.Hijacked {
+		return nil, nil, http.ErrHijacked
+	}
+	rw.Hijacked = true
+	c := rw.HijackConn
+	return c, bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c)), nil
+}
+
+// CloseNotify implements http.CloseNotifier. The returned channel
+// receives a value when Disconnect is called.
+func (rw *ResponseRecorder) CloseNotify() <-chan bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.closeNotify == nil {
+		rw.closeNotify = make(chan bool, 1)
+		if rw.disconnected {
+			rw.closeNotify <- true
+		}
+	}
+	return rw.closeNotify
+}
+
+// WithDisconnect returns a shallow copy of r whose context is canceled
+// when Disconnect is called.
+func (rw *ResponseRecorder) WithDisconnect(r *http.Request) *http.Request {
+	ctx, cancel := context.WithCancel(r.Context())
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.disconnected {
+		cancel()
+	} else {
+		rw.cancels = append(rw.cancels, cancel)
+	}
+	return r.WithContext(ctx)
+}
+
+// Disconnect simulates the client going away while the handler runs:
+// it notifies the channel returned by CloseNotify and cancels the
+// contexts of the requests returned by WithDisconnect.
+// Unlike the other methods, it may be called concurrently with the
+// handler.
+func (rw *ResponseRecorder) Disconnect() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.disconnected {
+		return
+	}
+	rw.disconnected = true
+	if rw.closeNotify != nil {
+		rw.closeNotify <- true
+	}
+	for _, cancel := range rw.cancels {
+		cancel()
+	}
+	rw.cancels = nil
 }
 
 // Result returns the response generated by the handler.
@@ -158,6 +350,13 @@ func (rw *ResponseRecorder) Flush() {
 // The Response.Body is guaranteed to be non-nil and Body.Read call is
 // guaranteed to not return any error other than io.EOF.
 //
+// The Response.ContentLength is the value of the Content-Length header.
+// Without one, it is, like the server would send, the length of a body
+// of at most 2048 bytes if the handler did not flush it, stream it with
+// a Transfer-Encoding or trailers, or respond with a status that
+// permits no body; and -1 otherwise. Result does not know the method of
+// the request: see ResultFor for the response to a HEAD request.
+//
 // Result must only be called after the handler has finished running.
 func (rw *ResponseRecorder) Result() *http.Response {
 	if rw.result != nil {
@@ -182,6 +381,11 @@ func (rw *ResponseRecorder) Result() *http.Response {
 		res.Body = ioutil.NopCloser(bytes.NewReader(rw.Body.Bytes()))
 	}
 	res.ContentLength = parseContentLength(res.Header.Get("Content-Length"))
+	if _, ok := res.Header["Content-Length"]; !ok && rw.buffered() {
+		// Like the server, report the length of a response
+		// that was completely buffered.
+		res.ContentLength = int64(rw.written)
+	}
 
 	if trailers, ok := rw.snapHeader["Trailer"]; ok {
 		res.Trailer = make(http.Header, len(trailers))
@@ -218,6 +422,70 @@ func (rw *ResponseRecorder) Result() *http.Response {
 	return res
 }
 
+// ResultFor is like Result, but the returned Response has its Request
+// field set to req, as if it were the response to req. Unlike Result,
+// which returns a Response with a nil Request, each call returns a new
+// Response, sharing the headers and body of the one returned by Result.
+//
+// ResultFor must only be called after the handler has finished running.
+func (rw *ResponseRecorder) ResultFor(req *http.Request) *http.Response {
+	res := *rw.Result()
+	res.Request = req
+	if req.Method == "HEAD" && rw.written == 0 && res.Header.Get("Content-Length") == "" {
+		// The server sends no length for a HEAD response
+		// without a body.
+		res.ContentLength = -1
+	}
+	return &res
+}
+
+// bodyAllowedForStatus reports whether a given response status code
+// permits a body. See RFC 2616, section 4.4.
+//
+// This is a copy of the same function in net/http/transfer.go.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == 204:
+		return false
+	case status == 304:
+		return false
+	}
+	return true
+}
+
+// bufferBeforeChunkingSize is the size of the buffer in which the
+// server holds the start of a response body. The server only sends
+// the length of a body that fits in it.
+const bufferBeforeChunkingSize = 2048
+
+// buffered reports whether the response was written as one buffered
+// body that the server would send with its length, rather than
+// streamed by flushing, with a Transfer-Encoding or trailers, or for
+// being larger than bufferBeforeChunkingSize, and whether its status
+// permits a body.
+func (rw *ResponseRecorder) buffered() bool {
+	if rw.Flushed || rw.Hijacked || rw.written > bufferBeforeChunkingSize {
+		return false
+	}
+	if !bodyAllowedForStatus(rw.Code) {
+		return false
+	}
+	if _, ok := rw.snapHeader["Transfer-Encoding"]; ok {
+		return false
+	}
+	if _, ok := rw.snapHeader["Trailer"]; ok {
+		return false
+	}
+	for k := range rw.HeaderMap {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
 // parseContentLength trims whitespace from s and returns -1 if no value
 // is set, or the value if it's >= 0.
 //
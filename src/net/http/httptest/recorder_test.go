@@ -5,9 +5,16 @@
 package httptest
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -102,6 +109,30 @@ func TestRecorder(t *testing.T) {
 			return nil
 		}
 	}
+	hasFlushPoints := func(want ...int) checkFunc {
+		return func(rec *ResponseRecorder) error {
+			if !reflect.DeepEqual(rec.FlushPoints, want) {
+				return fmt.Errorf("FlushPoints = %v; want %v", rec.FlushPoints, want)
+			}
+			return nil
+		}
+	}
+	hasInformational := func(want ...InformationalResponse) checkFunc {
+		return func(rec *ResponseRecorder) error {
+			if !reflect.DeepEqual(rec.Informational, want) {
+				return fmt.Errorf("Informational = %v; want %v", rec.Informational, want)
+			}
+			return nil
+		}
+	}
+	hasWriteHeaderCalls := func(want ...int) checkFunc {
+		return func(rec *ResponseRecorder) error {
+			if !reflect.DeepEqual(rec.WriteHeaderCalls, want) {
+				return fmt.Errorf("WriteHeaderCalls = %v; want %v", rec.WriteHeaderCalls, want)
+			}
+			return nil
+		}
+	}
 	hasContentLength := func(length int64) checkFunc {
 		return func(rec *ResponseRecorder) error {
 			if got := rec.Result().ContentLength; got != length {
@@ -273,6 +304,141 @@ func TestRecorder(t *testing.T) {
 			},
 			check(hasStatus(200), hasContents("Some body"), hasContentLength(9)),
 		},
+		{
+			"informational responses",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+				w.WriteHeader(103) // Early Hints
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(200)
+				io.WriteString(w, "<html>")
+			},
+			check(
+				hasInformational(InformationalResponse{
+					Code:   103,
+					Header: http.Header{"Link": {"</style.css>; rel=preload; as=style"}},
+				}),
+				hasStatus(200),
+				hasResultStatusCode(200),
+				hasHeader("Link", "</style.css>; rel=preload; as=style"),
+				hasHeader("Content-Type", "text/html"),
+				hasContents("<html>"),
+			),
+		},
+		{
+			"buffered body without Content-Length",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "Some body")
+			},
+			check(hasStatus(200), hasContents("Some body"), hasContentLength(9)),
+		},
+		{
+			"empty body",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+			},
+			check(hasStatus(200), hasContentLength(0)),
+		},
+		{
+			"no content",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(204)
+			},
+			check(hasStatus(204), hasContentLength(-1)),
+		},
+		{
+			"not modified",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(304)
+			},
+			check(hasStatus(304), hasContentLength(-1)),
+		},
+		{
+			"body filling the server's buffer",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, strings.Repeat("x", 2048))
+			},
+			check(hasContentLength(2048)),
+		},
+		{
+			"body larger than the server's buffer",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, strings.Repeat("x", 2049))
+			},
+			check(hasContentLength(-1)),
+		},
+		{
+			"flushed body",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "Some ")
+				w.(http.Flusher).Flush()
+				io.WriteString(w, "body")
+			},
+			check(hasContents("Some body"), hasContentLength(-1)),
+		},
+		{
+			"explicitly chunked body",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Transfer-Encoding", "chunked")
+				io.WriteString(w, "Some body")
+			},
+			check(hasContents("Some body"), hasContentLength(-1)),
+		},
+		{
+			"body with trailers",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Trailer-A")
+				io.WriteString(w, "Some body")
+				w.Header().Set("Trailer-A", "valuea")
+			},
+			check(hasContents("Some body"), hasContentLength(-1), hasTrailer("Trailer-A", "valuea")),
+		},
+		{
+			"flush points",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, ev := range []string{"data: a\n\n", "data: bb\n\n", "data: ccc\n\n"} {
+					io.WriteString(w, ev)
+					w.(http.Flusher).Flush()
+				}
+			},
+			check(
+				hasFlush(true),
+				hasFlushPoints(9, 19, 30),
+				hasContents("data: a\n\ndata: bb\n\ndata: ccc\n\n"),
+			),
+		},
+		{
+			"no flush points",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "data: a\n\n")
+			},
+			check(hasFlush(false), hasFlushPoints()),
+		},
+		{
+			"superfluous WriteHeader calls",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(201)
+				w.WriteHeader(202)
+			},
+			check(hasStatus(201), hasWriteHeaderCalls(201, 202)),
+		},
+		{
+			"implicit WriteHeader is not recorded",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "hi")
+				w.WriteHeader(202)
+			},
+			check(hasStatus(200), hasWriteHeaderCalls(202)),
+		},
+		{
+			"101 is not informational",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusSwitchingProtocols)
+				w.WriteHeader(200)
+			},
+			check(hasInformational(), hasStatus(101)),
+		},
 	}
 	r, _ := http.NewRequest("GET", "http://foo.com/", nil)
 	for _, tt := range tests {
@@ -286,3 +452,251 @@ func TestRecorder(t *testing.T) {
 		}
 	}
 }
+
+func TestRecorderResultFor(t *testing.T) {
+	req := NewRequest("POST", "http://foo.com/path", nil)
+	rec := NewRecorder()
+	rec.Header().Set("X-Foo", "1")
+	rec.WriteHeader(201)
+	io.WriteString(rec, "body")
+
+	res := rec.ResultFor(req)
+	if res.Request != req {
+		t.Errorf("ResultFor(req).Request = %v; want req", res.Request)
+	}
+	if res.StatusCode != 201 || res.Header.Get("X-Foo") != "1" {
+		t.Errorf("ResultFor(req) = %d with X-Foo %q; want 201 with X-Foo 1", res.StatusCode, res.Header.Get("X-Foo"))
+	}
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "body" {
+		t.Errorf("ResultFor(req).Body = %q; want %q", body, "body")
+	}
+	if got := rec.Result().Request; got != nil {
+		t.Errorf("Result().Request = %v; want nil", got)
+	}
+
+	// The server sends no length for a HEAD response without a body.
+	rec = NewRecorder()
+	rec.WriteHeader(200)
+	if got := rec.ResultFor(NewRequest("HEAD", "/", nil)).ContentLength; got != -1 {
+		t.Errorf("ResultFor(HEAD request).ContentLength = %d; want -1", got)
+	}
+	if got := rec.ResultFor(NewRequest("GET", "/", nil)).ContentLength; got != 0 {
+		t.Errorf("ResultFor(GET request).ContentLength = %d; want 0", got)
+	}
+}
+
+func TestRecorderHijack(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		if conn != c1 {
+			t.Errorf("Hijack returned conn %v; want HijackConn", conn)
+		}
+		go func() {
+			brw.WriteString("raw bytes")
+			brw.Flush()
+			conn.Close()
+		}()
+		if _, err := w.Write([]byte("ignored")); err != http.ErrHijacked {
+			t.Errorf("Write after Hijack: err = %v; want %v", err, http.ErrHijacked)
+		}
+		w.WriteHeader(500)
+		if _, _, err := w.(http.Hijacker).Hijack(); err != http.ErrHijacked {
+			t.Errorf("second Hijack: err = %v; want %v", err, http.ErrHijacked)
+		}
+	}
+
+	rec := NewRecorder()
+	rec.HijackConn = c1
+	handler(rec, NewRequest("GET", "/", nil))
+	got, err := ioutil.ReadAll(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "raw bytes" {
+		t.Errorf("read %q from conn; want %q", got, "raw bytes")
+	}
+	if !rec.Hijacked {
+		t.Error("Hijacked = false; want true")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Body = %q; want empty", rec.Body)
+	}
+	res := rec.Result()
+	if res.StatusCode != 200 || len(res.Header) != 0 {
+		t.Errorf("Result() = %d with header %v; want no response recorded", res.StatusCode, res.Header)
+	}
+
+	rec = NewRecorder()
+	if _, _, err := rec.Hijack(); err != http.ErrNotSupported {
+		t.Errorf("Hijack without HijackConn: err = %v; want %v", err, http.ErrNotSupported)
+	}
+}
+
+func TestRecorderWriteHook(t *testing.T) {
+	errGone := errors.New("client gone")
+	tests := []struct {
+		name     string
+		hook     func(p []byte) (int, error)
+		write    func(w http.ResponseWriter) (int, error)
+		wantN    int
+		wantErr  error
+		wantBody string
+	}{
+		{
+			name:     "no error",
+			hook:     func(p []byte) (int, error) { return 0, nil },
+			write:    func(w http.ResponseWriter) (int, error) { return w.Write([]byte("hello")) },
+			wantN:    5,
+			wantBody: "hello",
+		},
+		{
+			name:    "immediate error",
+			hook:    func(p []byte) (int, error) { return 0, errGone },
+			write:   func(w http.ResponseWriter) (int, error) { return w.Write([]byte("hello")) },
+			wantErr: errGone,
+		},
+		{
+			name:     "short write",
+			hook:     func(p []byte) (int, error) { return 3, errGone },
+			write:    func(w http.ResponseWriter) (int, error) { return w.Write([]byte("hello")) },
+			wantN:    3,
+			wantErr:  errGone,
+			wantBody: "hel",
+		},
+		{
+			name:     "short WriteString",
+			hook:     func(p []byte) (int, error) { return 3, errGone },
+			write:    func(w http.ResponseWriter) (int, error) { return io.WriteString(w, "hello") },
+			wantN:    3,
+			wantErr:  errGone,
+			wantBody: "hel",
+		},
+	}
+	for _, tt := range tests {
+		rec := NewRecorder()
+		rec.WriteHook = tt.hook
+		n, err := tt.write(rec)
+		if n != tt.wantN || err != tt.wantErr {
+			t.Errorf("%s: write = %d, %v; want %d, %v", tt.name, n, err, tt.wantN, tt.wantErr)
+		}
+		if got := rec.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: Body = %q; want %q", tt.name, got, tt.wantBody)
+		}
+	}
+
+	// A handler that gives up after the first failed write.
+	rec := NewRecorder()
+	calls := 0
+	rec.WriteHook = func(p []byte) (int, error) {
+		calls++
+		if calls == 2 {
+			return 1, errGone
+		}
+		return len(p), nil
+	}
+	for _, s := range []string{"one ", "two ", "three"} {
+		if _, err := io.WriteString(rec, s); err != nil {
+			break
+		}
+	}
+	if got, want := rec.Body.String(), "one t"; got != want {
+		t.Errorf("Body = %q; want %q", got, want)
+	}
+}
+
+func TestRecorderMaxBodyBytes(t *testing.T) {
+	const total = 10 << 20
+	rec := NewRecorder()
+	rec.MaxBodyBytes = 1024
+	chunk := bytes.Repeat([]byte("x"), 64<<10)
+	written := 0
+	for written < total {
+		var n int
+		var err error
+		if written%(2*len(chunk)) == 0 {
+			n, err = rec.Write(chunk)
+		} else {
+			n, err = rec.WriteString(string(chunk))
+		}
+		if n != len(chunk) || err != nil {
+			t.Fatalf("write after %d bytes = %d, %v; want %d, nil", written, n, err, len(chunk))
+		}
+		written += n
+	}
+	if got := rec.Body.Len(); got != 1024 {
+		t.Errorf("Body.Len() = %d; want 1024", got)
+	}
+	if !rec.BodyTruncated {
+		t.Error("BodyTruncated = false; want true")
+	}
+
+	rec = NewRecorder()
+	rec.MaxBodyBytes = 5
+	io.WriteString(rec, "hello")
+	if rec.Body.String() != "hello" || rec.BodyTruncated {
+		t.Errorf("Body = %q, BodyTruncated = %v; want %q, false", rec.Body, rec.BodyTruncated, "hello")
+	}
+}
+
+func TestRecorderDisconnect(t *testing.T) {
+	for _, useContext := range []bool{false, true} {
+		rec := NewRecorder()
+		req := NewRequest("GET", "/", nil)
+		if useContext {
+			req = rec.WithDisconnect(req)
+		}
+		wrote := make(chan bool)
+		done := make(chan bool)
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			defer close(done)
+			var gone <-chan struct{}
+			var closed <-chan bool
+			if useContext {
+				gone = r.Context().Done()
+			} else {
+				closed = w.(http.CloseNotifier).CloseNotify()
+			}
+			for {
+				select {
+				case <-gone:
+					return
+				case <-closed:
+					return
+				case wrote <- true:
+					io.WriteString(w, "event\n")
+				}
+			}
+		}
+		go handler(rec, req)
+
+		for i := 0; i < 3; i++ {
+			<-wrote
+		}
+		rec.Disconnect()
+		<-done
+		if got, want := strings.Count(rec.Body.String(), "event\n"), 3; got < want {
+			t.Errorf("useContext=%v: handler wrote %d events; want at least %d", useContext, got, want)
+		}
+	}
+
+	// Disconnecting before the handler asks still notifies it.
+	rec := NewRecorder()
+	rec.Disconnect()
+	rec.Disconnect()
+	select {
+	case <-rec.CloseNotify():
+	default:
+		t.Error("CloseNotify after Disconnect not notified")
+	}
+	if err := rec.WithDisconnect(NewRequest("GET", "/", nil)).Context().Err(); err != context.Canceled {
+		t.Errorf("request context error after Disconnect = %v; want %v", err, context.Canceled)
+	}
+}
@@ -116,6 +116,22 @@ func (addrs addrList) partition(strategy func(Addr) bool) (primaries, fallbacks
 	return
 }
 
+// prefer returns a copy of addrs in which the addresses for which
+// strategy reports true come first. The relative order of the
+// addresses is otherwise preserved.
+func (addrs addrList) prefer(strategy func(Addr) bool) addrList {
+	preferred := make(addrList, 0, len(addrs))
+	var others addrList
+	for _, addr := range addrs {
+		if strategy(addr) {
+			preferred = append(preferred, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+	return append(preferred, others...)
+}
+
 // filterAddrList applies a filter to a list of IP addresses,
 // yielding a list of Addr objects. Known filters are nil, ipv4only,
 // and ipv6only. It returns every address when the filter is nil.
@@ -9,6 +9,7 @@ import (
 	"internal/nettrace"
 	"internal/singleflight"
 	"sync"
+	"time"
 )
 
 // protocols contains minimal mappings between internet protocol
@@ -104,6 +105,9 @@ var DefaultResolver = &Resolver{}
 // A Resolver looks up names and numbers.
 //
 // A nil *Resolver is equivalent to a zero Resolver.
+//
+// A copy of a Resolver made after its first lookup shares the caches
+// enabled by MaxNegativeTTL and CacheTTL with the original.
 type Resolver struct {
 	// PreferGo controls whether Go's built-in DNS resolver is preferred
 	// on platforms where it's available. It is equivalent to setting
@@ -133,10 +137,92 @@ type Resolver struct {
 	// If nil, the default dialer is used.
 	Dial func(ctx context.Context, network, address string) (Conn, error)
 
+	// MaxNegativeTTL, if positive, enables caching of negative
+	// answers by Go's built-in DNS resolver. After a DNS server
+	// reports that a name does not exist, lookups of the name
+	// fail without querying a server for the negative caching
+	// TTL of the response (the lesser of the TTL and MINIMUM
+	// fields of its SOA record, as specified by RFC 2308), but
+	// for at most MaxNegativeTTL. Responses without an SOA record
+	// are not cached.
+	MaxNegativeTTL time.Duration
+
+	// HostsPath optionally specifies the hosts file consulted by
+	// Go's built-in resolver in place of the system's, typically
+	// /etc/hosts. Host and address lookups using a Resolver with
+	// a HostsPath always use Go's built-in resolver, as the C
+	// library resolver cannot read an alternate file.
+	// If empty, the system's hosts file is used.
+	// HostsPath is ignored on Windows and Plan 9, where lookups
+	// are made by the operating system.
+	HostsPath string
+
+	// Delegate optionally selects another Resolver to look up
+	// name, so as to compose resolvers for split-horizon DNS: it
+	// can, for instance, send lookups of the names of an internal
+	// domain to a Resolver using the internal DNS servers and
+	// leave the others to r. It is called with the name of each
+	// lookup except reverse and port lookups.
+	// If Delegate is nil or returns nil or r, r looks up the name.
+	Delegate func(name string) *Resolver
+
+	// CacheTTL, if positive, enables caching of the answers to
+	// address lookups, including those made by dials, so that
+	// repeated lookups of a name do not query the system again.
+	// Answers of Go's built-in DNS resolver are cached for the
+	// least TTL of their records, but for at most CacheTTL; other
+	// answers are cached for CacheTTL. Lookups that fail because
+	// the name does not exist are cached as well; those made by
+	// Go's built-in DNS resolver for the negative caching TTL
+	// described for MaxNegativeTTL, and bounded by it if positive,
+	// but for at most CacheTTL.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum number of names whose answers are
+	// cached when CacheTTL is positive. If zero, a default of
+	// 1000 names is used.
+	CacheSize int
+
+	// caches is allocated on first use; see getCaches.
+	caches *resolverCaches
+
 	// TODO(bradfitz): optional interface impl override hook
 	// TODO(bradfitz): Timeout time.Duration?
 }
 
+// resolverCachesMu guards the allocation of Resolver.caches.
+var resolverCachesMu sync.Mutex
+
+// A resolverCaches holds the caches of a Resolver. They are held by
+// pointer, so that a copy of a Resolver made after its first lookup
+// shares them, with their locks, rather than copying a lock and
+// sharing the maps it guards.
+type resolverCaches struct {
+	negative dnsNegativeCache
+	answers  dnsAnswerCache
+	lookups  singleflight.Group // see lookupGroupFor
+}
+
+// getCaches returns the caches of r, allocating them on first use.
+func (r *Resolver) getCaches() *resolverCaches {
+	resolverCachesMu.Lock()
+	defer resolverCachesMu.Unlock()
+	if r.caches == nil {
+		r.caches = new(resolverCaches)
+	}
+	return r.caches
+}
+
+// forName returns the Resolver that looks up name for r.
+func (r *Resolver) forName(name string) *Resolver {
+	if r.Delegate != nil {
+		if d := r.Delegate(name); d != nil {
+			return d
+		}
+	}
+	return r
+}
+
 // LookupHost looks up the given host using the local resolver.
 // It returns a slice of that host's addresses.
 func LookupHost(host string) (addrs []string, err error) {
@@ -154,6 +240,9 @@ func (r *Resolver) LookupHost(ctx context.Context, host string) (addrs []string,
 	if ip := ParseIP(host); ip != nil {
 		return []string{host}, nil
 	}
+	if d := r.forName(host); d != r {
+		return d.LookupHost(ctx, host)
+	}
 	return r.lookupHost(ctx, host)
 }
 
@@ -182,6 +271,14 @@ func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, err
 	if ip := ParseIP(host); ip != nil {
 		return []IPAddr{{IP: ip}}, nil
 	}
+	if d := r.forName(host); d != r {
+		return d.LookupIPAddr(ctx, host)
+	}
+	if r.CacheTTL > 0 {
+		if addrs, err, ok := r.getCaches().answers.get(host); ok {
+			return addrs, err
+		}
+	}
 	trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
 	if trace != nil && trace.DNSStart != nil {
 		trace.DNSStart(host)
@@ -195,8 +292,12 @@ func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, err
 	}
 
 	dnsWaitGroup.Add(1)
-	ch, called := lookupGroup.DoChan(host, func() (interface{}, error) {
+	group := r.lookupGroupFor()
+	ch, called := group.DoChan(host, func() (interface{}, error) {
 		defer dnsWaitGroup.Done()
+		if r.CacheTTL > 0 {
+			return r.lookupIPAndCache(ctx, resolverFunc, host)
+		}
 		return testHookLookupIP(ctx, resolverFunc, host)
 	})
 	if !called {
@@ -211,7 +312,7 @@ func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, err
 		// complete. See issue 8602.
 		ctxErr := ctx.Err()
 		if ctxErr == context.DeadlineExceeded {
-			lookupGroup.Forget(host)
+			group.Forget(host)
 		}
 		err := mapErr(ctxErr)
 		if trace != nil && trace.DNSDone != nil {
@@ -227,12 +328,89 @@ func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, err
 	}
 }
 
+// LookupIPAddrSorted looks up host using the local resolver, like
+// LookupIPAddr, and returns its addresses ordered by preference for
+// use as destinations, following the destination address selection
+// rules of RFC 6724 given the source addresses available on the host.
+func (r *Resolver) LookupIPAddrSorted(ctx context.Context, host string) ([]IPAddr, error) {
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	sortByRFC6724(addrs)
+	return addrs, nil
+}
+
+// IPAddrStatus is an address returned by Resolver.LookupIPAddrStatus.
+type IPAddrStatus struct {
+	IPAddr
+
+	// Reachable reports whether the host has a source address
+	// from which the address can be reached.
+	Reachable bool
+}
+
+// LookupIPAddrStatus looks up host using the local resolver, like
+// LookupIPAddrSorted, and reports for each address whether the host
+// has a source address for it. Addresses without a source address
+// are ordered last by RFC 6724, and dials to them fail; this
+// reports why. It is intended for diagnosing connectivity.
+func (r *Resolver) LookupIPAddrStatus(ctx context.Context, host string) ([]IPAddrStatus, error) {
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	srcs := testHookSrcAddrs(addrs)
+	sortByRFC6724withSrcs(addrs, srcs)
+	res := make([]IPAddrStatus, len(addrs))
+	for i, addr := range addrs {
+		res[i] = IPAddrStatus{IPAddr: addr, Reachable: srcs[i] != nil}
+	}
+	return res, nil
+}
+
+// lookupIPAndCache looks up host with fn, like LookupIPAddr, and
+// adds the answer to the cache of r.
+func (r *Resolver) lookupIPAndCache(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+	ttl := &dnsAnswerTTL{ttl: r.CacheTTL, negative: r.CacheTTL}
+	addrs, err := testHookLookupIP(context.WithValue(ctx, dnsAnswerTTLKey{}, ttl), fn, host)
+	if err == nil || isNoSuchHost(err) {
+		size := r.CacheSize
+		if size == 0 {
+			size = defaultCacheSize
+		}
+		d := ttl.ttl
+		if err != nil {
+			d = ttl.negative
+		}
+		r.getCaches().answers.add(host, addrs, err, d, size)
+	}
+	return addrs, err
+}
+
+// isNoSuchHost reports whether err reports that a name does not exist.
+func isNoSuchHost(err error) bool {
+	dnsErr, ok := err.(*DNSError)
+	return ok && dnsErr.Err == errNoSuchHost.Error()
+}
+
 // lookupGroup merges LookupIPAddr calls together for lookups
 // for the same host. The lookupGroup key is is the LookupIPAddr.host
 // argument.
 // The return values are ([]IPAddr, error).
 var lookupGroup singleflight.Group
 
+// lookupGroupFor returns the group merging the LookupIPAddr calls of r:
+// lookupGroup, or, if r has settings that change its answers or cache
+// them, its own group, so that its lookups are not merged with those
+// of differently configured resolvers.
+func (r *Resolver) lookupGroupFor() *singleflight.Group {
+	if r.HostsPath != "" || r.CacheTTL > 0 || r.MaxNegativeTTL > 0 {
+		return &r.getCaches().lookups
+	}
+	return &lookupGroup
+}
+
 // lookupIPReturn turns the return values from singleflight.Do into
 // the return values from LookupIP.
 func lookupIPReturn(addrsi interface{}, err error, shared bool) ([]IPAddr, error) {
@@ -288,7 +466,7 @@ func (r *Resolver) LookupPort(ctx context.Context, network, service string) (por
 // contain DNS "CNAME" records, as long as host resolves to
 // address records.
 func LookupCNAME(host string) (cname string, err error) {
-	return DefaultResolver.lookupCNAME(context.Background(), host)
+	return DefaultResolver.LookupCNAME(context.Background(), host)
 }
 
 // LookupCNAME returns the canonical name for the given host.
@@ -302,7 +480,7 @@ func LookupCNAME(host string) (cname string, err error) {
 // contain DNS "CNAME" records, as long as host resolves to
 // address records.
 func (r *Resolver) LookupCNAME(ctx context.Context, host string) (cname string, err error) {
-	return r.lookupCNAME(ctx, host)
+	return r.forName(host).lookupCNAME(ctx, host)
 }
 
 // LookupSRV tries to resolve an SRV query of the given service,
@@ -315,7 +493,7 @@ func (r *Resolver) LookupCNAME(ctx context.Context, host string) (cname string,
 // publishing SRV records under non-standard names, if both service
 // and proto are empty strings, LookupSRV looks up name directly.
 func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
-	return DefaultResolver.lookupSRV(context.Background(), service, proto, name)
+	return DefaultResolver.LookupSRV(context.Background(), service, proto, name)
 }
 
 // LookupSRV tries to resolve an SRV query of the given service,
@@ -328,37 +506,37 @@ func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err err
 // publishing SRV records under non-standard names, if both service
 // and proto are empty strings, LookupSRV looks up name directly.
 func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*SRV, err error) {
-	return r.lookupSRV(ctx, service, proto, name)
+	return r.forName(name).lookupSRV(ctx, service, proto, name)
 }
 
 // LookupMX returns the DNS MX records for the given domain name sorted by preference.
 func LookupMX(name string) ([]*MX, error) {
-	return DefaultResolver.lookupMX(context.Background(), name)
+	return DefaultResolver.LookupMX(context.Background(), name)
 }
 
 // LookupMX returns the DNS MX records for the given domain name sorted by preference.
 func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*MX, error) {
-	return r.lookupMX(ctx, name)
+	return r.forName(name).lookupMX(ctx, name)
 }
 
 // LookupNS returns the DNS NS records for the given domain name.
 func LookupNS(name string) ([]*NS, error) {
-	return DefaultResolver.lookupNS(context.Background(), name)
+	return DefaultResolver.LookupNS(context.Background(), name)
 }
 
 // LookupNS returns the DNS NS records for the given domain name.
 func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*NS, error) {
-	return r.lookupNS(ctx, name)
+	return r.forName(name).lookupNS(ctx, name)
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
 func LookupTXT(name string) ([]string, error) {
-	return DefaultResolver.lookupTXT(context.Background(), name)
+	return DefaultResolver.LookupTXT(context.Background(), name)
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
 func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
-	return r.lookupTXT(ctx, name)
+	return r.forName(name).lookupTXT(ctx, name)
 }
 
 // LookupAddr performs a reverse lookup for the given address, returning a list
@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -791,3 +792,117 @@ func TestLookupNonLDH(t *testing.T) {
 		t.Fatalf("lookup error = %v, want %v", err, errNoSuchHost)
 	}
 }
+
+func TestResolverCache(t *testing.T) {
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	queries := make(map[string]int)
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		queries[host]++
+		if strings.HasPrefix(host, "nx.") {
+			return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host}
+		}
+		return []IPAddr{{IP: IPv4(192, 0, 2, byte(queries[host]))}}, nil
+	}
+
+	const ttl = 100 * time.Millisecond
+	r := &Resolver{CacheTTL: ttl, CacheSize: 2}
+	ctx := context.Background()
+	lookup := func(host string, want IP) {
+		t.Helper()
+		addrs, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			t.Fatalf("LookupIPAddr(%q): %v", host, err)
+		}
+		if len(addrs) != 1 || !addrs[0].IP.Equal(want) {
+			t.Errorf("LookupIPAddr(%q) = %v; want [%v]", host, addrs, want)
+		}
+	}
+
+	// The second lookup is answered from the cache.
+	lookup("a.example", IPv4(192, 0, 2, 1))
+	lookup("a.example", IPv4(192, 0, 2, 1))
+	if queries["a.example"] != 1 {
+		t.Errorf("got %d queries for a.example; want 1", queries["a.example"])
+	}
+
+	// So are lookups of nonexistent names.
+	for i := 0; i < 2; i++ {
+		if _, err := r.LookupIPAddr(ctx, "nx.example"); !isNoSuchHost(err) {
+			t.Errorf("LookupIPAddr(nx.example) = %v; want %v", err, errNoSuchHost)
+		}
+	}
+	if queries["nx.example"] != 1 {
+		t.Errorf("got %d queries for nx.example; want 1", queries["nx.example"])
+	}
+
+	// The cache holds at most CacheSize names, evicting the answer
+	// expiring first.
+	lookup("b.example", IPv4(192, 0, 2, 1))
+	lookup("b.example", IPv4(192, 0, 2, 1))
+	lookup("a.example", IPv4(192, 0, 2, 2))
+	if queries["b.example"] != 1 || queries["a.example"] != 2 {
+		t.Errorf("got %d queries for b.example and %d for a.example; want 1 and 2", queries["b.example"], queries["a.example"])
+	}
+
+	// Answers expire after the TTL.
+	time.Sleep(ttl + 50*time.Millisecond)
+	lookup("b.example", IPv4(192, 0, 2, 2))
+	if queries["b.example"] != 2 {
+		t.Errorf("got %d queries for b.example after expiry; want 2", queries["b.example"])
+	}
+
+	// Without a CacheTTL, every lookup queries.
+	r = &Resolver{}
+	lookup("c.example", IPv4(192, 0, 2, 1))
+	lookup("c.example", IPv4(192, 0, 2, 2))
+}
+
+// Copies of a Resolver made after its first lookup share its caches,
+// and can be used concurrently with it.
+func TestResolverCopyCache(t *testing.T) {
+	origTestHookLookupIP := testHookLookupIP
+	defer func() { testHookLookupIP = origTestHookLookupIP }()
+	var mu sync.Mutex
+	queries := make(map[string]int)
+	testHookLookupIP = func(ctx context.Context, fn func(context.Context, string) ([]IPAddr, error), host string) ([]IPAddr, error) {
+		mu.Lock()
+		queries[host]++
+		mu.Unlock()
+		return []IPAddr{{IP: IPv4(192, 0, 2, 1)}}, nil
+	}
+
+	r := &Resolver{CacheTTL: time.Hour}
+	ctx := context.Background()
+	if _, err := r.LookupIPAddr(ctx, "a.example"); err != nil {
+		t.Fatal(err)
+	}
+	c := *r
+	c.PreferGo = true
+
+	var wg sync.WaitGroup
+	for _, r := range []*Resolver{r, &c} {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(r *Resolver, host string) {
+				defer wg.Done()
+				if _, err := r.LookupIPAddr(ctx, host); err != nil {
+					t.Error(err)
+				}
+			}(r, fmt.Sprintf("%d.example", i))
+		}
+	}
+	wg.Wait()
+
+	if _, err := c.LookupIPAddr(ctx, "a.example"); err != nil {
+		t.Fatal(err)
+	}
+	if queries["a.example"] != 1 {
+		t.Errorf("got %d queries for a.example; want 1, answered from the cache shared by the copy", queries["a.example"])
+	}
+	for host, n := range queries {
+		if n != 1 {
+			t.Errorf("got %d queries for %s; want 1", n, host)
+		}
+	}
+}
@@ -75,7 +75,7 @@ func (r *Resolver) dial(ctx context.Context, network, server string) (dnsConn, e
 }
 
 func (r *Resolver) lookupHost(ctx context.Context, host string) (addrs []string, err error) {
-	order := systemConf().hostLookupOrder(host)
+	order := r.hostLookupOrder(host)
 	if !r.PreferGo && order == hostLookupCgo {
 		if addrs, err, ok := cgoLookupHost(ctx, host); ok {
 			return addrs, err
@@ -90,7 +90,7 @@ func (r *Resolver) lookupIP(ctx context.Context, host string) (addrs []IPAddr, e
 	if r.PreferGo {
 		return r.goLookupIP(ctx, host)
 	}
-	order := systemConf().hostLookupOrder(host)
+	order := r.hostLookupOrder(host)
 	if order == hostLookupCgo {
 		if addrs, err, ok := cgoLookupIP(ctx, host); ok {
 			return addrs, err
@@ -186,7 +186,7 @@ func (r *Resolver) lookupTXT(ctx context.Context, name string) ([]string, error)
 }
 
 func (r *Resolver) lookupAddr(ctx context.Context, addr string) ([]string, error) {
-	if !r.PreferGo && systemConf().canUseCgo() {
+	if !r.PreferGo && r.HostsPath == "" && systemConf().canUseCgo() {
 		if ptrs, err, ok := cgoLookupPTR(ctx, addr); ok {
 			return ptrs, err
 		}
@@ -387,11 +387,28 @@ var (
 	// For connection setup and write operations.
 	errMissingAddress = errors.New("missing address")
 
+	// For connection setup operations with Dialer.SelectConn.
+	errConnRejected = errors.New("connection rejected by SelectConn")
+
+	// For connection setup operations with Dialer.DialTCP.
+	errNoTCPConn = errors.New("Dialer.DialTCP returned no connection and no error")
+
 	// For both read and write operations.
 	errCanceled         = errors.New("operation was canceled")
 	ErrWriteToConnected = errors.New("use of WriteTo with pre-connected connection")
 )
 
+// ErrTLSReserve is the error reported by a dial that could not complete
+// while leaving the time reserved by Dialer.ReserveForTLS before its
+// deadline. It is a timeout error.
+var ErrTLSReserve error = &tlsReserveError{}
+
+type tlsReserveError struct{}
+
+func (e *tlsReserveError) Error() string   { return "dial would leave less time than reserved for TLS" }
+func (e *tlsReserveError) Timeout() bool   { return true }
+func (e *tlsReserveError) Temporary() bool { return true }
+
 // mapErr maps from the context errors to the historical internal net
 // error values.
 //
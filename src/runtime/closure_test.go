@@ -51,3 +51,140 @@ func BenchmarkCallClosure4(b *testing.B) {
 		_, ss = addr2()
 	}
 }
+
+// closureImmediate passes the address of a local variable to a
+// closure that it calls directly, which must not move the variable
+// to the heap. The loop keeps the closure from being inlined.
+func closureImmediate(i int) int {
+	j := i
+	func(p *int) {
+		for k := 0; k < 2; k++ {
+			*p += i
+		}
+	}(&j)
+	return j
+}
+
+func BenchmarkCallClosureImmediate(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s += closureImmediate(i)
+	}
+}
+
+func TestCallClosureImmediateAllocs(t *testing.T) {
+	n := testing.AllocsPerRun(1000, func() {
+		s += closureImmediate(s)
+	})
+	if n != 0 {
+		t.Fatalf("want 0 allocs, got %v", n)
+	}
+}
+
+//go:noinline
+func callWide(f func() int) int {
+	return f()
+}
+
+// closureWide calls a closure capturing eight variables, which does
+// not escape, so its environment must be allocated on the stack.
+func closureWide(i int) int {
+	a, b, c, d, e, f, g, h := i, i+1, i+2, i+3, i+4, i+5, i+6, i+7
+	return callWide(func() int {
+		return a + b + c + d + e + f + g + h
+	})
+}
+
+func BenchmarkCallClosureWide(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s += closureWide(i)
+	}
+}
+
+func TestCallClosureWideAllocs(t *testing.T) {
+	n := testing.AllocsPerRun(1000, func() {
+		s += closureWide(s)
+	})
+	if n != 0 {
+		t.Fatalf("want 0 allocs, got %v", n)
+	}
+}
+
+func TestCallClosureAddrAllocs(t *testing.T) {
+	// The variables whose address the closures of BenchmarkCallClosure2,
+	// 3 and 4 leak must be allocated on the heap.
+	for _, f := range []func(){
+		func() {
+			j := s
+			s += func() int {
+				ss = &j
+				return 2
+			}()
+		},
+		func() { ss = addr1(s) },
+		func() { _, ss = addr2() },
+	} {
+		if n := testing.AllocsPerRun(1000, f); n != 1 {
+			t.Errorf("want 1 alloc, got %v", n)
+		}
+	}
+}
+
+// deferClosure defers a closure capturing a local variable, which does
+// not escape, so neither the variable nor the closure's environment
+// may be allocated on the heap.
+func deferClosure(i int) (r int) {
+	j := i
+	defer func() {
+		r += j
+	}()
+	j++
+	return j
+}
+
+var deferred func()
+
+// deferClosureStored is like deferClosure, but also stores the
+// deferred closure, which must then be allocated on the heap.
+func deferClosureStored(i int) (r int) {
+	j := i
+	f := func() {
+		r += j
+	}
+	deferred = f
+	defer f()
+	j++
+	return j
+}
+
+func BenchmarkDeferClosure(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		func() {
+			defer func() {
+				s++
+			}()
+		}()
+	}
+}
+
+func BenchmarkDeferClosureCapture(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s += deferClosure(i)
+	}
+}
+
+func TestDeferClosureAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(1000, func() {
+		s += deferClosure(s)
+	}); n != 0 {
+		t.Errorf("deferred closure: want 0 allocs, got %v", n)
+	}
+	if n := testing.AllocsPerRun(1000, func() {
+		s += deferClosureStored(s)
+	}); n == 0 {
+		t.Errorf("stored deferred closure: want allocs, got none")
+	}
+}
@@ -11,20 +11,18 @@ package escape
 var sink interface{}
 
 func ClosureCallArgs0() {
-	x := 0         // ERROR "moved to heap: x"
+	x := 0
 	func(p *int) { // ERROR "p does not escape" "func literal does not escape"
 		*p = 1
-		// BAD: x should not escape to heap here
-	}(&x) // ERROR "&x escapes to heap"
+	}(&x) // ERROR "&x does not escape"
 }
 
 func ClosureCallArgs1() {
-	x := 0 // ERROR "moved to heap: x"
+	x := 0
 	for {
 		func(p *int) { // ERROR "p does not escape" "func literal does not escape"
 			*p = 1
-			// BAD: x should not escape to heap here
-		}(&x) // ERROR "&x escapes to heap"
+		}(&x) // ERROR "&x does not escape"
 	}
 }
 
@@ -55,7 +53,7 @@ func ClosureCallArgs4() {
 
 func ClosureCallArgs5() {
 	x := 0                     // ERROR "moved to heap: x"
-	sink = func(p *int) *int { // ERROR "leaking param: p to result ~r1" "func literal does not escape" "\(func literal\)\(&x\) escapes to heap"
+	sink = func(p *int) *int { // ERROR "leaking param: p" "func literal does not escape" "\(func literal\)\(&x\) escapes to heap"
 		return p
 	}(&x) // ERROR "&x escapes to heap"
 }
@@ -79,11 +77,10 @@ func ClosureCallArgs7() {
 }
 
 func ClosureCallArgs8() {
-	x := 0               // ERROR "moved to heap: x"
+	x := 0
 	defer func(p *int) { // ERROR "p does not escape" "func literal does not escape"
 		*p = 1
-		// BAD: x should not escape to heap here
-	}(&x) // ERROR "&x escapes to heap"
+	}(&x) // ERROR "&x does not escape"
 }
 
 func ClosureCallArgs9() {
@@ -130,20 +127,18 @@ func ClosureCallArgs13() {
 func ClosureCallArgs14() {
 	x := 0 // ERROR "moved to heap: x"
 	// BAD: &x should not escape here
-	p := &x                  // ERROR "moved to heap: p" "&x escapes to heap"
+	p := &x                  // ERROR "&x escapes to heap"
 	_ = func(p **int) *int { // ERROR "leaking param: p to result ~r1 level=1" "func literal does not escape"
 		return *p
-		// BAD: p should not escape here
-	}(&p) // ERROR "&p escapes to heap"
+	}(&p) // ERROR "&p does not escape"
 }
 
 func ClosureCallArgs15() {
 	x := 0                      // ERROR "moved to heap: x"
-	p := &x                     // ERROR "moved to heap: p" "&x escapes to heap"
-	sink = func(p **int) *int { // ERROR "leaking param: p to result ~r1 level=1" "func literal does not escape" "\(func literal\)\(&p\) escapes to heap"
+	p := &x                     // ERROR "&x escapes to heap"
+	sink = func(p **int) *int { // ERROR "leaking param: p to result ~r1 level=1" "leaking param content: p" "func literal does not escape" "\(func literal\)\(&p\) escapes to heap"
 		return *p
-		// BAD: p should not escape here
-	}(&p) // ERROR "&p escapes to heap"
+	}(&p) // ERROR "&p does not escape"
 }
 
 func ClosureLeak1(s string) string { // ERROR "ClosureLeak1 s does not escape"
@@ -171,3 +166,45 @@ func ClosureLeak2a(a ...string) string { // ERROR "leaking param: a to result ~r
 func ClosureLeak2b(f func() string) string { // ERROR "leaking param: f to result ~r1 level=1"
 	return f()
 }
+
+func closureCall(f func() int) int { // ERROR "f does not escape"
+	return f()
+}
+
+// The environment of a closure capturing many variables is allocated
+// on the stack if the closure does not escape.
+func ClosureWide(i int) int {
+	a, b, c, d, e, f, g, h := i, i+1, i+2, i+3, i+4, i+5, i+6, i+7
+	return closureCall(func() int { // ERROR "func literal does not escape"
+		return a + b + c + d + e + f + g + h
+	})
+}
+
+func ClosureWideLeak(i int) {
+	a, b, c, d, e, f, g, h := i, i+1, i+2, i+3, i+4, i+5, i+6, i+7
+	sink = func() int { // ERROR "func literal escapes to heap"
+		return a + b + c + d + e + f + g + h
+	}
+}
+
+// A deferred closure outside a loop does not escape, so neither its
+// environment nor the variables it captures are allocated on the heap.
+func ClosureDefer(i int) (r int) {
+	j := i
+	defer func() { // ERROR "func literal does not escape"
+		r += j
+	}()
+	j++
+	return j
+}
+
+func ClosureDeferStored(i int) (r int) { // ERROR "moved to heap: r"
+	j := i        // ERROR "moved to heap: j"
+	f := func() { // ERROR "func literal escapes to heap"
+		r += j // ERROR "&r escapes to heap" "&j escapes to heap"
+	}
+	sink = f // ERROR "f escapes to heap"
+	defer f()
+	j++
+	return j
+}